@@ -0,0 +1,179 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"debug/elf"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// See libpkg/pkg_abi.c in the pkg source tree for the way pkg computes ABI
+// strings.
+
+type ABI struct {
+	OSVersion  uint32
+	Arch       string
+	ArchLegacy string
+}
+
+// ABI returns the ABI string of the package, e.g. "FreeBSD:13:amd64".
+func (abi ABI) ABI() string {
+	return fmt.Sprintf("FreeBSD:%d:%s", abi.MajorVersion(), abi.Arch)
+}
+
+// LegacyArch returns the architecture string used by older versions of pkg,
+// e.g. "freebsd:13:x86:64".
+func (abi ABI) LegacyArch() string {
+	return fmt.Sprintf("freebsd:%d:%s", abi.MajorVersion(), abi.ArchLegacy)
+}
+
+func (abi ABI) MajorVersion() uint32 {
+	return abi.OSVersion / 100000
+}
+
+// Matches returns true if an architecture string, either in ABI or in
+// legacy format, designates the ABI. As in pkg, the architecture component
+// of the string, or the whole string, can be the "*" wildcard.
+func (abi ABI) Matches(s string) bool {
+	if s == "*" {
+		return true
+	}
+
+	return matchABIString(s, abi.ABI()) || matchABIString(s, abi.LegacyArch())
+}
+
+func matchABIString(pattern, s string) bool {
+	patternParts := strings.SplitN(pattern, ":", 3)
+	parts := strings.SplitN(s, ":", 3)
+
+	if len(patternParts) != 3 || len(parts) != 3 {
+		return strings.EqualFold(pattern, s)
+	}
+
+	if !strings.EqualFold(patternParts[0], parts[0]) ||
+		patternParts[1] != parts[1] {
+		return false
+	}
+
+	return patternParts[2] == "*" || strings.EqualFold(patternParts[2], parts[2])
+}
+
+// elfArch returns the architecture of an ELF file in both ABI and legacy
+// formats, or false if the architecture cannot be identified.
+func elfArch(f *ELFFile) (string, string, bool) {
+	bits := "32"
+	if f.Class == elf.ELFCLASS64 {
+		bits = "64"
+	}
+
+	littleEndian := f.Data == elf.ELFDATA2LSB
+
+	switch f.Machine {
+	case elf.EM_386:
+		return "i386", "x86:32", true
+
+	case elf.EM_X86_64:
+		return "amd64", "x86:64", true
+
+	case elf.EM_AARCH64:
+		return "aarch64", "aarch64:64", true
+
+	case elf.EM_ARM:
+		// As pkg does, we use the Tag_CPU_arch build attribute to tell
+		// ARMv6 from ARMv7 (FreeBSD does not support older versions).
+		if !littleEndian {
+			break
+		}
+
+		switch f.ARMCPUArch {
+		case 6, 7, 8, 9: // v6, v6KZ, v6T2, v6K
+			return "armv6", "armv6:32:el:eabi:hardfp", true
+		case 10: // v7
+			return "armv7", "armv7:32:el:eabi:hardfp", true
+		}
+
+	case elf.EM_PPC:
+		return "powerpc", "powerpc:32:eb", true
+
+	case elf.EM_PPC64:
+		if littleEndian {
+			return "powerpc64le", "powerpc:64:el", true
+		}
+
+		return "powerpc64", "powerpc:64:eb", true
+
+	case elf.EM_RISCV:
+		return "riscv" + bits, "riscv:" + bits + ":hf", true
+	}
+
+	return "", "", false
+}
+
+// detectABI computes the ABI of the package from FreeBSD ELF files. It
+// returns nil if the package does not contain any FreeBSD ELF file whose
+// architecture can be identified.
+func detectABI(elfFiles map[string]*ELFFile) (*ABI, error) {
+	paths := make([]string, 0, len(elfFiles))
+	for path := range elfFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var abi *ABI
+	var abiPath string
+
+	for _, path := range paths {
+		f := elfFiles[path]
+
+		// Files without ABI note are either not built for FreeBSD or do not
+		// carry version information (e.g. object files).
+		if f.FreeBSDVersion == 0 {
+			continue
+		}
+
+		arch, archLegacy, found := elfArch(f)
+		if !found {
+			warn("cannot identify the architecture of %q (machine type %v), "+
+				"ignoring it for ABI detection", path, f.Machine)
+			continue
+		}
+
+		fileABI := ABI{
+			OSVersion:  f.FreeBSDVersion,
+			Arch:       arch,
+			ArchLegacy: archLegacy,
+		}
+
+		if abi == nil {
+			abi = &fileABI
+			abiPath = path
+			continue
+		}
+
+		if fileABI.ABI() != abi.ABI() {
+			return nil, fmt.Errorf("%q has ABI %q but %q has ABI %q",
+				abiPath, abi.ABI(), path, fileABI.ABI())
+		}
+
+		// The package requires the most recent version of all files.
+		if fileABI.OSVersion > abi.OSVersion {
+			abi.OSVersion = fileABI.OSVersion
+		}
+	}
+
+	return abi, nil
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"debug/elf"
+	"testing"
+)
+
+func TestABIMatches(t *testing.T) {
+	abi := ABI{OSVersion: 1302001, Arch: "amd64", ArchLegacy: "x86:64"}
+
+	tests := []struct {
+		s       string
+		matches bool
+	}{
+		{"FreeBSD:13:amd64", true},
+		{"freebsd:13:AMD64", true},
+		{"freebsd:13:x86:64", true},
+		{"FreeBSD:13:*", true},
+		{"freebsd:13:*", true},
+		{"*", true},
+		{"FreeBSD:14:amd64", false},
+		{"FreeBSD:14:*", false},
+		{"FreeBSD:1:*", false},
+		{"FreeBSD:13:aarch64", false},
+		{"Linux:13:*", false},
+		{"amd64", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if matches := abi.Matches(test.s); matches != test.matches {
+			t.Errorf("%q: got %t, expected %t", test.s, matches, test.matches)
+		}
+	}
+}
+
+func TestDetectABI(t *testing.T) {
+	amd64 := &ELFFile{
+		Machine:        elf.EM_X86_64,
+		Class:          elf.ELFCLASS64,
+		Data:           elf.ELFDATA2LSB,
+		FreeBSDVersion: 1302001,
+	}
+
+	armv6 := &ELFFile{
+		Machine:        elf.EM_ARM,
+		Class:          elf.ELFCLASS32,
+		Data:           elf.ELFDATA2LSB,
+		FreeBSDVersion: 1302001,
+		ARMCPUArch:     6,
+	}
+
+	armv7 := *armv6
+	armv7.ARMCPUArch = 10
+	armv7.FreeBSDVersion = 1300139
+
+	armUnknown := *armv6
+	armUnknown.ARMCPUArch = 0
+
+	unknown := *amd64
+	unknown.Machine = elf.EM_SPARCV9
+
+	tests := []struct {
+		name       string
+		files      map[string]*ELFFile
+		abi        string
+		archLegacy string
+	}{
+		{"no files", nil, "", ""},
+		{"amd64", map[string]*ELFFile{"/a": amd64},
+			"FreeBSD:13:amd64", "freebsd:13:x86:64"},
+		{"armv6", map[string]*ELFFile{"/a": armv6},
+			"FreeBSD:13:armv6", "freebsd:13:armv6:32:el:eabi:hardfp"},
+		{"armv7", map[string]*ELFFile{"/a": &armv7},
+			"FreeBSD:13:armv7", "freebsd:13:armv7:32:el:eabi:hardfp"},
+		{"unknown arm version", map[string]*ELFFile{"/a": &armUnknown},
+			"", ""},
+		{"unknown machine", map[string]*ELFFile{"/a": &unknown}, "", ""},
+		{"unknown machine and amd64",
+			map[string]*ELFFile{"/a": &unknown, "/b": amd64},
+			"FreeBSD:13:amd64", "freebsd:13:x86:64"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			abi, err := detectABI(test.files)
+			if err != nil {
+				t.Fatalf("cannot detect ABI: %v", err)
+			}
+
+			var abiString, archLegacy string
+			if abi != nil {
+				abiString = abi.ABI()
+				archLegacy = abi.LegacyArch()
+			}
+
+			if abiString != test.abi || archLegacy != test.archLegacy {
+				t.Errorf("got (%q, %q), expected (%q, %q)",
+					abiString, archLegacy, test.abi, test.archLegacy)
+			}
+		})
+	}
+}
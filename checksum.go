@@ -0,0 +1,111 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+type ChecksumEntry struct {
+	FilePath    string
+	PackagePath string
+	Info        fs.FileInfo
+	Sum         string
+}
+
+func (e *ChecksumEntry) ComputeSum(cache *ChecksumCache) error {
+	fullPath := e.FilePath
+
+	if e.Info.IsDir() {
+		return nil
+	}
+
+	if e.Info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return fmt.Errorf("cannot read symlink %q: %w", fullPath, err)
+		}
+
+		e.Sum = "1$" + hex.EncodeToString(SymlinkSHA256Checksum(target))
+	} else {
+		if cache != nil {
+			if sum, found := cache.Lookup(fullPath, e.Info); found {
+				e.Sum = sum
+				return nil
+			}
+		}
+
+		checksum, err := FileSHA256Checksum(fullPath)
+		if err != nil {
+			return fmt.Errorf("cannot compute checksum of %q: %w",
+				fullPath, err)
+		}
+
+		e.Sum = hex.EncodeToString(checksum)
+
+		if cache != nil {
+			cache.Store(fullPath, e.Info, e.Sum)
+		}
+	}
+
+	return nil
+}
+
+// ComputeChecksums computes the checksum of all entries using up to jobs
+// goroutines. If cache is not nil, it is used to avoid computing checksums of
+// files which have not changed since the last build. If several checksums
+// cannot be computed, the error returned is the one of the first entry in the
+// list so that the result does not depend on scheduling.
+func ComputeChecksums(entries []*ChecksumEntry, jobs int, cache *ChecksumCache) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	errs := make([]error, len(entries))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range indexes {
+				errs[idx] = entries[idx].ComputeSum(cache)
+			}
+		}()
+	}
+
+	for i := range entries {
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// The checksum cache associates the absolute path of files with their
+// checksum. An entry is only used if the size, modification time and
+// identity of the file have not changed since the checksum was computed.
+
+type ChecksumCache struct {
+	Path    string
+	Entries map[string]ChecksumCacheEntry
+
+	mutex    sync.Mutex
+	modified bool
+}
+
+type ChecksumCacheEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Device  uint64 `json:"device,omitempty"`
+	Inode   uint64 `json:"inode,omitempty"`
+	Sum     string `json:"sum"`
+}
+
+func DefaultChecksumCachePath() (string, error) {
+	dirPath, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dirPath, "fpkg", "checksums.json"), nil
+}
+
+func NewChecksumCacheEntry(info fs.FileInfo, sum string) ChecksumCacheEntry {
+	id, _ := FileIdentity(info)
+
+	return ChecksumCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Device:  id.Device,
+		Inode:   id.Inode,
+		Sum:     sum,
+	}
+}
+
+func LoadChecksumCache(filePath string) (*ChecksumCache, error) {
+	c := ChecksumCache{
+		Path:    filePath,
+		Entries: make(map[string]ChecksumCacheEntry),
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &c, nil
+		}
+
+		return nil, fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+
+	if err := json.Unmarshal(data, &c.Entries); err != nil {
+		return nil, fmt.Errorf("cannot decode %q: %w", filePath, err)
+	}
+
+	return &c, nil
+}
+
+func (c *ChecksumCache) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.modified {
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(c.Entries); err != nil {
+		return fmt.Errorf("cannot encode cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+		return fmt.Errorf("cannot create directory: %w", err)
+	}
+
+	// Write the cache to a temporary file first so that an interrupted build
+	// never leaves a truncated cache behind.
+	tmpPath := c.Path + ".tmp"
+
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("cannot write %q: %w", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, c.Path); err != nil {
+		return fmt.Errorf("cannot rename %q: %w", tmpPath, err)
+	}
+
+	c.modified = false
+	return nil
+}
+
+func (c *ChecksumCache) Lookup(filePath string, info fs.FileInfo) (string, bool) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, found := c.Entries[absPath]
+	if !found {
+		return "", false
+	}
+
+	entry2 := NewChecksumCacheEntry(info, entry.Sum)
+	if entry2 != entry {
+		return "", false
+	}
+
+	return entry.Sum, true
+}
+
+func (c *ChecksumCache) Store(filePath string, info fs.FileInfo, sum string) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.Entries[absPath] = NewChecksumCacheEntry(info, sum)
+	c.modified = true
+}
+
+// Prune removes entries whose file does not exist anymore or has been
+// modified since it was cached. It returns the number of entries removed.
+func (c *ChecksumCache) Prune() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	n := 0
+
+	// Only regular files are cached, but the path of an entry can be a
+	// symbolic link followed when building the package; its entry then
+	// describes the file the link points to.
+	for filePath, entry := range c.Entries {
+		info, err := os.Stat(filePath)
+		if err == nil && NewChecksumCacheEntry(info, entry.Sum) == entry {
+			continue
+		}
+
+		delete(c.Entries, filePath)
+		c.modified = true
+		n++
+	}
+
+	return n
+}
+
+func (c *ChecksumCache) SortedPaths() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	paths := make([]string, 0, len(c.Entries))
+	for filePath := range c.Entries {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
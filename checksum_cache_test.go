@@ -0,0 +1,153 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChecksumCacheLookup(t *testing.T) {
+	dirPath := t.TempDir()
+
+	cache, err := LoadChecksumCache(filepath.Join(dirPath, "checksums.json"))
+	if err != nil {
+		t.Fatalf("cannot load cache: %v", err)
+	}
+
+	filePath := filepath.Join(dirPath, "file")
+	mtime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	writeTestFile(t, filePath, "foo", mtime)
+	info := statTestFile(t, filePath)
+
+	if _, found := cache.Lookup(filePath, info); found {
+		t.Fatalf("unexpected cache hit for an unknown file")
+	}
+
+	cache.Store(filePath, info, "sum")
+
+	tests := []struct {
+		name  string
+		data  string
+		mtime time.Time
+		found bool
+	}{
+		{"unchanged", "foo", mtime, true},
+		{"modification time", "foo", mtime.Add(time.Second), false},
+		{"size", "foobar", mtime, false},
+		{"restored", "foo", mtime, true},
+	}
+
+	for _, test := range tests {
+		writeTestFile(t, filePath, test.data, test.mtime)
+		info := statTestFile(t, filePath)
+
+		sum, found := cache.Lookup(filePath, info)
+		if found != test.found {
+			t.Errorf("%s: got found %t, expected %t",
+				test.name, found, test.found)
+		} else if found && sum != "sum" {
+			t.Errorf("%s: got sum %q, expected %q", test.name, sum, "sum")
+		}
+	}
+}
+
+func TestChecksumCachePrune(t *testing.T) {
+	dirPath := t.TempDir()
+	cachePath := filepath.Join(dirPath, "checksums.json")
+
+	cache, err := LoadChecksumCache(cachePath)
+	if err != nil {
+		t.Fatalf("cannot load cache: %v", err)
+	}
+
+	mtime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, name := range []string{"unchanged", "modified", "deleted"} {
+		filePath := filepath.Join(dirPath, name)
+		writeTestFile(t, filePath, "foo", mtime)
+		cache.Store(filePath, statTestFile(t, filePath), name)
+	}
+
+	// Entries of links followed when building the package describe the
+	// file they point to.
+	for name, target := range map[string]string{
+		"followed":          "unchanged",
+		"followed-modified": "modified",
+	} {
+		linkPath := filepath.Join(dirPath, name)
+		if err := os.Symlink(target, linkPath); err != nil {
+			t.Fatalf("cannot create symlink: %v", err)
+		}
+
+		info, err := os.Stat(linkPath)
+		if err != nil {
+			t.Fatalf("cannot stat %q: %v", linkPath, err)
+		}
+
+		cache.Store(linkPath, info, name)
+	}
+
+	writeTestFile(t, filepath.Join(dirPath, "modified"), "bar", mtime.Add(1))
+
+	if err := os.Remove(filepath.Join(dirPath, "deleted")); err != nil {
+		t.Fatalf("cannot delete file: %v", err)
+	}
+
+	if n := cache.Prune(); n != 3 {
+		t.Errorf("got %d pruned entries, expected 3", n)
+	}
+
+	if err := cache.Save(); err != nil {
+		t.Fatalf("cannot save cache: %v", err)
+	}
+
+	cache, err = LoadChecksumCache(cachePath)
+	if err != nil {
+		t.Fatalf("cannot load cache: %v", err)
+	}
+
+	paths := cache.SortedPaths()
+	if len(paths) != 2 || paths[0] != filepath.Join(dirPath, "followed") ||
+		paths[1] != filepath.Join(dirPath, "unchanged") {
+		t.Errorf("got cached paths %v after pruning", paths)
+	}
+}
+
+func writeTestFile(t *testing.T, filePath, data string, mtime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(filePath, []byte(data), 0644); err != nil {
+		t.Fatalf("cannot write %q: %v", filePath, err)
+	}
+
+	if err := os.Chtimes(filePath, mtime, mtime); err != nil {
+		t.Fatalf("cannot set times of %q: %v", filePath, err)
+	}
+}
+
+func statTestFile(t *testing.T, filePath string) os.FileInfo {
+	t.Helper()
+
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		t.Fatalf("cannot stat %q: %v", filePath, err)
+	}
+
+	return info
+}
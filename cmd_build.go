@@ -17,28 +17,23 @@ package main
 import (
 	"archive/tar"
 	"bytes"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
-	"io/ioutil"
 	"os"
 	"path"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 	"unicode"
 
 	"github.com/exograd/go-program"
+	"github.com/yuin/gopher-lua/parse"
 )
 
 func cmdBuild(p *program.Program) {
-	dirPath := p.ArgumentValue("directory")
-	if dirPath == "" {
-		dirPath = "."
-	}
-
 	configPath := p.OptionValue("config")
 	config := DefaultGenerationConfig()
 	if err := config.LoadFile(configPath); err != nil {
@@ -53,11 +48,98 @@ func cmdBuild(p *program.Program) {
 		p.Fatal("missing or empty version")
 	}
 
-	manifest, err := generateManifest(config, dirPath)
+	// The package directory is only optional if the configuration contains
+	// sources.
+	if dirPath := p.ArgumentValue("directory"); dirPath != "" ||
+		len(config.Sources) == 0 {
+		if dirPath == "" {
+			dirPath = "."
+		}
+
+		source := GenerationConfigSource{
+			Path:        dirPath,
+			Destination: config.Prefix,
+		}
+
+		config.Sources = append([]GenerationConfigSource{source},
+			config.Sources...)
+	}
+
+	if p.IsOptionSet("compression") {
+		config.Compression = Compression(p.OptionValue("compression"))
+	}
+
+	if p.IsOptionSet("compression-level") {
+		levelString := p.OptionValue("compression-level")
+		level, err := strconv.Atoi(levelString)
+		if err != nil {
+			p.Fatal("invalid compression level %q", levelString)
+		}
+
+		config.CompressionLevel = level
+	}
+
+	if value := os.Getenv("SOURCE_DATE_EPOCH"); value != "" {
+		timestamp, err := parseTimestamp(value)
+		if err != nil {
+			p.Fatal("invalid SOURCE_DATE_EPOCH value %q: %v", value, err)
+		}
+
+		config.Timestamp = &timestamp
+	}
+
+	if p.IsOptionSet("exclude") {
+		for _, glob := range strings.Split(p.OptionValue("exclude"), ",") {
+			pattern := GenerationConfigPattern{Glob: glob}
+			if err := pattern.Validate(); err != nil {
+				p.Fatal("invalid exclusion pattern: %v", err)
+			}
+
+			config.Exclude = append(config.Exclude, pattern)
+		}
+	}
+
+	if p.IsOptionSet("jobs") {
+		jobsString := p.OptionValue("jobs")
+		jobs, err := strconv.Atoi(jobsString)
+		if err != nil || jobs < 1 {
+			p.Fatal("invalid number of jobs %q", jobsString)
+		}
+
+		config.Jobs = jobs
+	}
+
+	if p.IsOptionSet("timestamp") {
+		value := p.OptionValue("timestamp")
+		timestamp, err := parseTimestamp(value)
+		if err != nil {
+			p.Fatal("invalid timestamp %q: %v", value, err)
+		}
+
+		config.Timestamp = &timestamp
+	}
+
+	err := config.Compression.ValidateLevel(config.CompressionLevel)
+	if err != nil {
+		p.Fatal("invalid compression settings: %v", err)
+	}
+
+	var cache *ChecksumCache
+	if p.IsOptionSet("cache") {
+		cache = loadChecksumCache(p)
+	}
+
+	manifest, err := generateManifest(config, cache)
 	if err != nil {
 		p.Fatal("cannot generate manifest: %v", err)
 	}
 
+	if cache != nil {
+		if err := cache.Save(); err != nil {
+			p.Error("cannot save checksum cache: %v", err)
+		}
+	}
+
 	archivePath := manifest.PackageFilename()
 
 	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
@@ -66,7 +148,7 @@ func cmdBuild(p *program.Program) {
 		p.Fatal("cannot open %q: %v", archivePath, err)
 	}
 
-	if err := createArchive(config, dirPath, manifest, archive); err != nil {
+	if err := createArchive(config, manifest, archive); err != nil {
 		if removeErr := os.Remove(archivePath); removeErr != nil {
 			p.Error("cannot delete %q: %v", archivePath, removeErr)
 		}
@@ -74,10 +156,22 @@ func cmdBuild(p *program.Program) {
 		p.Fatal("cannot create archive: %v", err)
 	}
 
+	archiveInfo, err := archive.Stat()
+	if err != nil {
+		p.Fatal("cannot stat %q: %v", archivePath, err)
+	}
+
+	if err := archive.Close(); err != nil {
+		p.Fatal("cannot close %q: %v", archivePath, err)
+	}
+
+	p.Info("package size: %s, installed size: %s",
+		formatSize(archiveInfo.Size()), formatSize(manifest.Flatsize))
+
 	fmt.Printf("%s\n", archivePath)
 }
 
-func generateManifest(config *GenerationConfig, dirPath string) (*Manifest, error) {
+func generateManifest(config *GenerationConfig, cache *ChecksumCache) (*Manifest, error) {
 	m := NewManifest()
 
 	m.Name = config.Name
@@ -87,14 +181,32 @@ func generateManifest(config *GenerationConfig, dirPath string) (*Manifest, erro
 	m.WWW = config.WebsiteURI
 	m.Maintainer = config.Maintainer
 
-	if arch := config.Architecture; arch != "" {
-		m.Arch = config.Architecture
-	} else {
-		// "pkg add" will segfault if there is no arch field. See
-		// https://github.com/freebsd/pkg/issues/2070.
-		m.Arch = "*"
+	if len(config.Licenses) > 0 {
+		m.Licenses = config.Licenses
+
+		if logic := config.LicenseLogic; logic != "" {
+			m.LicenseLogic = logic
+		} else {
+			m.LicenseLogic = "single"
+		}
+	}
+
+	m.Categories = config.Categories
+	m.Annotations = config.Annotations
+
+	if len(config.Options) > 0 {
+		m.Options = make(map[string]string, len(config.Options))
+		for name, enabled := range config.Options {
+			if enabled {
+				m.Options[name] = "on"
+			} else {
+				m.Options[name] = "off"
+			}
+		}
 	}
 
+	m.Vital = config.Vital
+
 	if longDesc := config.LongDescription; longDesc != "" {
 		m.Desc = longDesc
 	} else {
@@ -117,6 +229,10 @@ func generateManifest(config *GenerationConfig, dirPath string) (*Manifest, erro
 		}
 	}
 
+	m.Provides = config.Provides
+	m.Requires = config.Requires
+	m.Conflicts = config.Conflicts
+
 	m.Users = make([]string, len(config.Users))
 	for i, user := range config.Users {
 		m.Users[i] = user.Name
@@ -127,9 +243,11 @@ func generateManifest(config *GenerationConfig, dirPath string) (*Manifest, erro
 		m.Groups[i] = group.Name
 	}
 
-	m.Prefix = "/"
+	m.Prefix = config.Prefix
+
+	for _, dirCfg := range config.Directories {
+		dir, _ := config.FindDirectory(dirCfg.Path)
 
-	for _, dir := range config.Directories {
 		var mdir ManifestDirectory
 
 		if dir.Owner != "" {
@@ -150,20 +268,133 @@ func generateManifest(config *GenerationConfig, dirPath string) (*Manifest, erro
 			mdir.Perm = "755"
 		}
 
-		m.Directories[dir.Path] = mdir
+		m.Directories[dirCfg.Path] = mdir
 	}
 
-	err := WalkDir(dirPath, func(relPath string, info fs.FileInfo) error {
-		fullPath := path.Join(dirPath, relPath)
+	entries, err := collectSourceFiles(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ComputeChecksums(entries, config.Jobs, cache); err != nil {
+		return nil, err
+	}
 
-		if !info.Mode().IsRegular() {
-			return nil
+	var elfFiles map[string]*ELFFile
+	if config.DetectShlibs || config.DetectABI {
+		elfFiles, err = ReadELFFiles(entries)
+		if err != nil {
+			return nil, err
 		}
+	}
+
+	m.ShlibsRequired, m.ShlibsProvided =
+		analyzeSharedLibraries(config, entries, elfFiles)
 
-		checksum, err := FileSHA256Checksum(fullPath)
+	// Architecture
+	var abi *ABI
+	if config.DetectABI {
+		abi, err = detectABI(elfFiles)
 		if err != nil {
-			return fmt.Errorf("cannot compute checksum of %q: %w",
-				fullPath, err)
+			return nil, fmt.Errorf("cannot detect ABI: %w", err)
+		}
+	}
+
+	if arch := config.Architecture; arch != "" {
+		if abi != nil && !abi.Matches(arch) {
+			return nil, fmt.Errorf("configured architecture %q does not "+
+				"match the ABI of packaged files %q", arch, abi.ABI())
+		}
+
+		m.Arch = arch
+
+		if abi != nil {
+			m.ABI = abi.ABI()
+		}
+	} else if abi != nil {
+		m.ABI = abi.ABI()
+		m.Arch = abi.LegacyArch()
+	} else {
+		// "pkg add" will segfault if there is no arch field. See
+		// https://github.com/freebsd/pkg/issues/2070.
+		m.Arch = "*"
+	}
+
+	if abi != nil {
+		if _, found := m.Annotations["FreeBSD_version"]; !found {
+			annotations := make(map[string]string, len(m.Annotations)+1)
+			for key, value := range m.Annotations {
+				annotations[key] = value
+			}
+
+			annotations["FreeBSD_version"] =
+				strconv.FormatUint(uint64(abi.OSVersion), 10)
+
+			m.Annotations = annotations
+		}
+	}
+
+	nonEmptyDirs := make(map[string]struct{})
+	for _, entry := range entries {
+		nonEmptyDirs[path.Dir(entry.PackagePath)] = struct{}{}
+	}
+
+	// The installed size only includes regular files; hard links are only
+	// counted once.
+	linkedFiles := make(map[FileID]struct{})
+
+	for _, entry := range entries {
+		relPath := entry.PackagePath
+		info := entry.Info
+
+		if info.IsDir() {
+			if !ownDirectory(config, relPath, nonEmptyDirs) {
+				continue
+			}
+
+			if _, found := m.Directories[relPath]; found {
+				continue
+			}
+
+			dirCfg, _ := config.FindDirectory(relPath)
+
+			mdir := ManifestDirectory{
+				Uname: config.FileOwner,
+				Gname: config.FileGroup,
+				Perm:  strconv.FormatInt(UnixPermissions(info.Mode()), 8),
+			}
+
+			if dirCfg.Owner != "" {
+				mdir.Uname = dirCfg.Owner
+			}
+
+			if dirCfg.Group != "" {
+				mdir.Gname = dirCfg.Group
+			}
+
+			if dirCfg.Mode != "" {
+				mdir.Perm = dirCfg.Mode
+			}
+
+			m.Directories[relPath] = mdir
+			continue
+		}
+
+		m.sourcePaths[relPath] = entry.FilePath
+
+		if info.Mode().IsRegular() {
+			id, linked, err := hardLinkIdentity(entry.FilePath, info)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, found := linkedFiles[id]; !linked || !found {
+				m.Flatsize += info.Size()
+			}
+
+			if linked {
+				linkedFiles[id] = struct{}{}
+			}
 		}
 
 		fileCfg, hasFileCfg := config.FindFile(relPath)
@@ -172,7 +403,7 @@ func generateManifest(config *GenerationConfig, dirPath string) (*Manifest, erro
 		if hasFileCfg && fileCfg.Mode != "" {
 			permString = fileCfg.Mode
 		} else {
-			permString = strconv.FormatInt(int64(info.Mode().Perm()), 8)
+			permString = strconv.FormatInt(UnixPermissions(info.Mode()), 8)
 		}
 
 		var uname string
@@ -189,25 +420,42 @@ func generateManifest(config *GenerationConfig, dirPath string) (*Manifest, erro
 			gname = config.FileGroup
 		}
 
-		if info.IsDir() {
-			m.Directories[relPath] = ManifestDirectory{
-				Uname: uname,
-				Gname: gname,
-				Perm:  permString,
-			}
-		} else {
-			m.Files[relPath] = ManifestFile{
-				Uname: uname,
-				Gname: gname,
-				Perm:  permString,
-				Sum:   hex.EncodeToString(checksum),
+		// Pkg merges local modifications of configuration files with new
+		// versions during upgrades, which only makes sense for regular
+		// files.
+		if hasFileCfg && fileCfg.Config {
+			if !info.Mode().IsRegular() {
+				return nil, fmt.Errorf("configuration file %q is not a "+
+					"regular file", relPath)
 			}
+
+			m.Config = append(m.Config, relPath)
 		}
 
-		return nil
-	})
-	if err != nil {
-		return nil, err
+		m.Files[relPath] = ManifestFile{
+			Uname: uname,
+			Gname: gname,
+			Perm:  permString,
+			Sum:   entry.Sum,
+		}
+	}
+
+	checkAccountIDs(config, m)
+
+	// Messages
+	for _, msg := range config.Messages {
+		mmsg := ManifestMessage{
+			Message:        msg.Message,
+			MinimumVersion: msg.MinimumVersion,
+			MaximumVersion: msg.MaximumVersion,
+		}
+
+		// Pkg displays messages without type in all cases.
+		if msg.Type != "always" {
+			mmsg.Type = msg.Type
+		}
+
+		m.Messages = append(m.Messages, mmsg)
 	}
 
 	// Scripts
@@ -216,23 +464,169 @@ func generateManifest(config *GenerationConfig, dirPath string) (*Manifest, erro
 		return nil, fmt.Errorf("cannot generate pre-install script: %w", err)
 	}
 
+	// Generated code runs before the user script so that the script can rely
+	// on users and groups created by the package.
 	m.Scripts["pre-install"] = string(preInstallData)
 
+	for _, phase := range scriptPhases {
+		script, found := config.Scripts[phase]
+		if !found {
+			continue
+		}
+
+		if generated := m.Scripts[phase]; generated != "" {
+			m.Scripts[phase] = generated + "\n" + script.Content
+		} else {
+			m.Scripts[phase] = script.Content
+		}
+	}
+
+	// Lua scripts
+	for _, phase := range scriptPhases {
+		script, found := config.LuaScripts[phase]
+		if !found {
+			continue
+		}
+
+		if config.CheckLuaScripts {
+			if err := checkLuaScript(script.Content, phase); err != nil {
+				return nil, err
+			}
+		}
+
+		if m.LuaScripts == nil {
+			m.LuaScripts = make(map[string][]string)
+		}
+
+		m.LuaScripts[phase] = []string{script.Content}
+	}
+
 	return m, nil
 }
 
-func createArchive(config *GenerationConfig, dirPath string, manifest *Manifest, archive io.Writer) error {
+// checkLuaScript checks the syntax of a Lua script; pkg would otherwise only
+// report syntax errors when installing or removing the package. The parser
+// only supports Lua 5.1 while pkg runs Lua 5.4, so scripts using newer syntax
+// (integer division, bitwise operators, attributes...) require the check to
+// be disabled with the check_lua_scripts setting.
+func checkLuaScript(script, phase string) error {
+	_, err := parse.Parse(strings.NewReader(script), phase)
+	if err != nil {
+		msg := strings.Join(strings.Fields(err.Error()), " ")
+		return fmt.Errorf("invalid %s lua script: %s (set check_lua_scripts "+
+			"to false for scripts using Lua 5.4 syntax)", phase, msg)
+	}
+
+	return nil
+}
+
+// checkAccountIDs warns about owners and groups whose numeric id is unknown;
+// archive entries use id 0 for them, but pkg still sets the owner and group
+// of installed files by name.
+func checkAccountIDs(config *GenerationConfig, m *Manifest) {
+	users := map[string]struct{}{config.FileOwner: {}}
+	groups := map[string]struct{}{config.FileGroup: {}}
+
+	for _, file := range m.Files {
+		users[file.Uname] = struct{}{}
+		groups[file.Gname] = struct{}{}
+	}
+
+	for _, dir := range m.Directories {
+		users[dir.Uname] = struct{}{}
+		groups[dir.Gname] = struct{}{}
+	}
+
+	for _, name := range sortedKeys(users) {
+		if _, found := config.UserID(name); !found {
+			warn("unknown id for user %q, using 0 in the archive (ids can "+
+				"be set with the user_ids setting)", name)
+		}
+	}
+
+	for _, name := range sortedKeys(groups) {
+		if _, found := config.GroupID(name); !found {
+			warn("unknown id for group %q, using 0 in the archive (ids can "+
+				"be set with the group_ids setting)", name)
+		}
+	}
+}
+
+func ownDirectory(config *GenerationConfig, dirPath string, nonEmptyDirs map[string]struct{}) bool {
+	listed := config.InRecursiveDirectory(dirPath)
+
+	// Directories below recursive directory rules are registered whatever
+	// the policy, as directories listed in the configuration.
+	switch config.OwnDirectories {
+	case DirectoryOwnershipEmpty:
+		_, nonEmpty := nonEmptyDirs[dirPath]
+		return !nonEmpty || listed
+
+	case DirectoryOwnershipAll:
+		return true
+	}
+
+	return listed
+}
+
+// hardLinkIdentity returns the identity of a regular file and whether other
+// paths are hard links to it. The information of a followed symbolic link
+// describes the file it points to, but the link itself is not a hard link.
+func hardLinkIdentity(filePath string, info fs.FileInfo) (FileID, bool, error) {
+	id, linked := FileIdentity(info)
+	if !linked {
+		return id, false, nil
+	}
+
+	linfo, err := os.Lstat(filePath)
+	if err != nil {
+		return FileID{}, false, fmt.Errorf("cannot stat %q: %w", filePath, err)
+	}
+
+	return id, linfo.Mode().IsRegular(), nil
+}
+
+func createArchive(config *GenerationConfig, manifest *Manifest, archive io.Writer) error {
+	// Tar headers only store whole seconds unless PAX records are used; we
+	// truncate timestamps so that the header format does not depend on the
+	// current time.
 	now := time.Now().UTC()
+	if config.Timestamp != nil {
+		now = config.Timestamp.UTC()
+	}
+	now = now.Truncate(time.Second)
+
+	cw, err := NewCompressionWriter(archive, config.Compression,
+		config.CompressionLevel)
+	if err != nil {
+		return fmt.Errorf("cannot create compression writer: %w", err)
+	}
+
+	w := tar.NewWriter(cw)
 
-	w := tar.NewWriter(archive)
+	writeHeader := func(header *tar.Header) error {
+		header.ModTime = now
 
-	addFile := func(name string, mode int64, owner, group string, data []byte) error {
+		// Unknown accounts were reported when generating the manifest.
+		header.Uid, _ = config.UserID(header.Uname)
+		header.Gid, _ = config.GroupID(header.Gname)
+
+		if err := w.WriteHeader(header); err != nil {
+			return fmt.Errorf("cannot write header: %w", err)
+		}
+
+		return nil
+	}
+
+	// Data are copied to the archive without being loaded in memory; the
+	// tar writer automatically switches to the PAX format for entries whose
+	// size cannot be represented in a USTAR header.
+	addFile := func(name string, mode int64, owner, group string, data io.Reader, size int64) error {
 		header := tar.Header{
 			Typeflag: tar.TypeReg,
 			Name:     name,
-			Size:     int64(len(data)),
+			Size:     size,
 			Mode:     mode,
-			ModTime:  now,
 			Uname:    owner,
 			Gname:    group,
 		}
@@ -241,23 +635,62 @@ func createArchive(config *GenerationConfig, dirPath string, manifest *Manifest,
 			header.Typeflag = tar.TypeDir
 		}
 
-		if owner := config.FileOwner; owner != "" {
-			header.Uname = owner
+		if err := writeHeader(&header); err != nil {
+			return err
 		}
 
-		if group := config.FileGroup; group != "" {
-			header.Gname = group
+		if data != nil {
+			if _, err := io.CopyN(w, data, size); err != nil {
+				return fmt.Errorf("cannot write data: %w", err)
+			}
 		}
 
-		if err := w.WriteHeader(&header); err != nil {
-			return fmt.Errorf("cannot write header: %w", err)
-		}
+		return nil
+	}
 
-		if _, err := w.Write(data); err != nil {
-			return fmt.Errorf("cannot write data: %w", err)
+	addFileFromPath := func(name string, mode int64, owner, group string, filePath string, size int64) error {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return fmt.Errorf("cannot open %q: %w", filePath, err)
 		}
+		defer file.Close()
 
-		return nil
+		return addFile(name, mode, owner, group, file, size)
+	}
+
+	addSymlink := func(name string, mode int64, owner, group, target string) error {
+		return writeHeader(&tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     name,
+			Linkname: target,
+			Mode:     mode,
+			Uname:    owner,
+			Gname:    group,
+		})
+	}
+
+	addHardlink := func(name string, mode int64, owner, group, target string) error {
+		return writeHeader(&tar.Header{
+			Typeflag: tar.TypeLink,
+			Name:     name,
+			Linkname: target,
+			Mode:     mode,
+			Uname:    owner,
+			Gname:    group,
+		})
+	}
+
+	// Compact manifest
+	compactManifestData, err := json.Marshal(manifest.Compact())
+	if err != nil {
+		return fmt.Errorf("cannot encode compact manifest: %w", err)
+	}
+
+	err = addFile("+COMPACT_MANIFEST", 0644, config.FileOwner,
+		config.FileGroup, bytes.NewReader(compactManifestData),
+		int64(len(compactManifestData)))
+	if err != nil {
+		return fmt.Errorf("cannot add compact manifest: %w", err)
 	}
 
 	// Manifest
@@ -267,12 +700,18 @@ func createArchive(config *GenerationConfig, dirPath string, manifest *Manifest,
 	}
 
 	err = addFile("+MANIFEST", 0644, config.FileOwner, config.FileGroup,
-		manifestData)
+		bytes.NewReader(manifestData), int64(len(manifestData)))
 	if err != nil {
 		return fmt.Errorf("cannot add manifest: %w", err)
 	}
 
 	// Files
+	followSymlinks := config.Symlinks == SymlinkPolicyFollow
+
+	// Regular files sharing the same identity are hard links: the first one
+	// is stored with its content, and the following ones as links to it.
+	linkTargets := make(map[FileID]string)
+
 	relPaths := make([]string, 0, len(manifest.Files))
 	for relPath := range manifest.Files {
 		relPaths = append(relPaths, relPath)
@@ -281,12 +720,7 @@ func createArchive(config *GenerationConfig, dirPath string, manifest *Manifest,
 
 	for _, relPath := range relPaths {
 		mfile := manifest.Files[relPath]
-		filePath := path.Join(dirPath, relPath)
-
-		data, err := ioutil.ReadFile(filePath)
-		if err != nil {
-			return fmt.Errorf("cannot read %q: %w", filePath, err)
-		}
+		filePath := manifest.sourcePaths[relPath]
 
 		perm, err := strconv.ParseInt(mfile.Perm, 8, 64)
 		if err != nil {
@@ -294,7 +728,53 @@ func createArchive(config *GenerationConfig, dirPath string, manifest *Manifest,
 				mfile.Perm, err)
 		}
 
-		err = addFile(relPath, perm, mfile.Uname, mfile.Gname, data)
+		info, err := os.Lstat(filePath)
+		if err != nil {
+			return fmt.Errorf("cannot stat %q: %w", filePath, err)
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 && !followSymlinks {
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				return fmt.Errorf("cannot read symlink %q: %w", filePath, err)
+			}
+
+			err = addSymlink(relPath, perm, mfile.Uname, mfile.Gname, target)
+			if err != nil {
+				return fmt.Errorf("cannot add %q: %w", filePath, err)
+			}
+
+			continue
+		}
+
+		// Followed symbolic links are stored as copies of their target, never
+		// as hard links.
+		id, linked := FileIdentity(info)
+		linked = linked && info.Mode().IsRegular()
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			info, err = os.Stat(filePath)
+			if err != nil {
+				return fmt.Errorf("cannot stat %q: %w", filePath, err)
+			}
+		}
+
+		if linked {
+			if target, found := linkTargets[id]; found {
+				err := addHardlink(relPath, perm, mfile.Uname, mfile.Gname,
+					target)
+				if err != nil {
+					return fmt.Errorf("cannot add %q: %w", filePath, err)
+				}
+
+				continue
+			}
+
+			linkTargets[id] = relPath
+		}
+
+		err = addFileFromPath(relPath, perm, mfile.Uname, mfile.Gname,
+			filePath, info.Size())
 		if err != nil {
 			return fmt.Errorf("cannot add %q: %w", filePath, err)
 		}
@@ -309,7 +789,6 @@ func createArchive(config *GenerationConfig, dirPath string, manifest *Manifest,
 
 	for _, relPath := range relPaths {
 		mdir := manifest.Directories[relPath]
-		filePath := path.Join(dirPath, relPath)
 
 		perm, err := strconv.ParseInt(mdir.Perm, 8, 64)
 		if err != nil {
@@ -317,9 +796,9 @@ func createArchive(config *GenerationConfig, dirPath string, manifest *Manifest,
 				mdir.Perm, err)
 		}
 
-		err = addFile(relPath, perm, mdir.Uname, mdir.Gname, nil)
+		err = addFile(relPath, perm, mdir.Uname, mdir.Gname, nil, 0)
 		if err != nil {
-			return fmt.Errorf("cannot add directory %q: %w", filePath, err)
+			return fmt.Errorf("cannot add directory %q: %w", relPath, err)
 		}
 	}
 
@@ -328,9 +807,47 @@ func createArchive(config *GenerationConfig, dirPath string, manifest *Manifest,
 		return fmt.Errorf("cannot close archive: %w", err)
 	}
 
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("cannot finalize compression: %w", err)
+	}
+
 	return nil
 }
 
+// parseTimestamp parses either a number of seconds since the epoch, as used
+// by SOURCE_DATE_EPOCH, or a RFC 3339 date.
+func parseTimestamp(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timestamp must be either a number " +
+			"of seconds since the epoch or a RFC 3339 date")
+	}
+
+	return t.UTC(), nil
+}
+
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+	value := float64(size)
+	unit := 0
+
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
 func generatePreInstall(config *GenerationConfig) ([]byte, error) {
 	if len(config.Groups) == 0 && len(config.Users) == 0 {
 		return nil, nil
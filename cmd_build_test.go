@@ -0,0 +1,226 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReproducibleBuild(t *testing.T) {
+	dirPath := t.TempDir()
+
+	files := map[string]string{
+		"bin/app":               "#!/bin/sh\necho app\n",
+		"etc/app.conf":          "debug = false\n",
+		"share/app/data.txt":    "data\n",
+		"share/app/a/b/c/d.txt": "d\n",
+	}
+
+	for name, data := range files {
+		filePath := filepath.Join(dirPath, name)
+
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("cannot create directory: %v", err)
+		}
+
+		if err := os.WriteFile(filePath, []byte(data), 0644); err != nil {
+			t.Fatalf("cannot write %q: %v", filePath, err)
+		}
+	}
+
+	if err := os.Symlink("app", filepath.Join(dirPath, "bin/app2")); err != nil {
+		t.Fatalf("cannot create symlink: %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dirPath, "var"), 0755); err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+
+	build := func(jobs int, mtime time.Time) []byte {
+		t.Helper()
+
+		// Modification times of source files must not matter.
+		for name := range files {
+			filePath := filepath.Join(dirPath, name)
+			if err := os.Chtimes(filePath, mtime, mtime); err != nil {
+				t.Fatalf("cannot set times of %q: %v", filePath, err)
+			}
+		}
+
+		config := loadTestConfig(t, `
+prefix: "/usr/local"
+timestamp: 1700000000
+own_directories: all
+`)
+		config.Jobs = jobs
+		config.Sources = []GenerationConfigSource{
+			{Path: dirPath, Destination: config.Prefix},
+		}
+
+		manifest, err := generateManifest(config, nil)
+		if err != nil {
+			t.Fatalf("cannot generate manifest: %v", err)
+		}
+
+		var buf bytes.Buffer
+		if err := createArchive(config, manifest, &buf); err != nil {
+			t.Fatalf("cannot create archive: %v", err)
+		}
+
+		return buf.Bytes()
+	}
+
+	data1 := build(1, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	data2 := build(8, time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	if !bytes.Equal(data1, data2) {
+		t.Errorf("builds produced different archives")
+	}
+}
+
+func TestHardLinks(t *testing.T) {
+	dirPath := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(dirPath, "bin"), 0755); err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+
+	files := map[string]string{
+		"bin/a": "hello\n",
+		"bin/c": "c\n\n",
+	}
+
+	for name, data := range files {
+		filePath := filepath.Join(dirPath, name)
+		if err := os.WriteFile(filePath, []byte(data), 0755); err != nil {
+			t.Fatalf("cannot write %q: %v", filePath, err)
+		}
+	}
+
+	err := os.Link(filepath.Join(dirPath, "bin/a"),
+		filepath.Join(dirPath, "bin/b"))
+	if err != nil {
+		t.Fatalf("cannot create hard link: %v", err)
+	}
+
+	// A followed symbolic link is a copy of its target, not a hard link.
+	if err := os.Symlink("a", filepath.Join(dirPath, "bin/s")); err != nil {
+		t.Fatalf("cannot create symlink: %v", err)
+	}
+
+	config := loadTestConfig(t, `
+prefix: "/usr/local"
+compression: "none"
+symlinks: "follow"
+`)
+	config.Sources = []GenerationConfigSource{
+		{Path: dirPath, Destination: config.Prefix},
+	}
+
+	manifest, err := generateManifest(config, nil)
+	if err != nil {
+		t.Fatalf("cannot generate manifest: %v", err)
+	}
+
+	if manifest.Flatsize != 15 {
+		t.Errorf("flatsize is %d, expected 15", manifest.Flatsize)
+	}
+
+	var buf bytes.Buffer
+	if err := createArchive(config, manifest, &buf); err != nil {
+		t.Fatalf("cannot create archive: %v", err)
+	}
+
+	headers := make(map[string]*tar.Header)
+
+	r := tar.NewReader(&buf)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("cannot read archive: %v", err)
+		}
+
+		headers[header.Name] = header
+	}
+
+	a := headers["/usr/local/bin/a"]
+	if a == nil || a.Typeflag != tar.TypeReg || a.Size != 6 {
+		t.Errorf("/usr/local/bin/a is not a 6 byte regular file")
+	}
+
+	s := headers["/usr/local/bin/s"]
+	if s == nil || s.Typeflag != tar.TypeReg || s.Size != 6 {
+		t.Errorf("/usr/local/bin/s is not a 6 byte regular file")
+	}
+
+	b := headers["/usr/local/bin/b"]
+	if b == nil || b.Typeflag != tar.TypeLink {
+		t.Errorf("/usr/local/bin/b is not a hard link")
+	} else if b.Linkname != "/usr/local/bin/a" {
+		t.Errorf("/usr/local/bin/b links to %q, expected %q",
+			b.Linkname, "/usr/local/bin/a")
+	}
+}
+
+func TestOwnDirectory(t *testing.T) {
+	nonEmptyDirs := map[string]struct{}{
+		"/usr/local/share":     {},
+		"/usr/local/share/doc": {},
+		"/usr/local/lib":       {},
+	}
+
+	tests := []struct {
+		policy DirectoryOwnership
+		path   string
+		owned  bool
+	}{
+		{DirectoryOwnershipNone, "/usr/local/share/doc", true},
+		{DirectoryOwnershipNone, "/usr/local/lib", false},
+		{DirectoryOwnershipNone, "/usr/local/empty", false},
+		{DirectoryOwnershipListed, "/usr/local/share/doc", true},
+		{DirectoryOwnershipListed, "/usr/local/lib", false},
+		{DirectoryOwnershipListed, "/usr/local/empty", false},
+		{DirectoryOwnershipEmpty, "/usr/local/share/doc", true},
+		{DirectoryOwnershipEmpty, "/usr/local/lib", false},
+		{DirectoryOwnershipEmpty, "/usr/local/empty", true},
+		{DirectoryOwnershipAll, "/usr/local/share/doc", true},
+		{DirectoryOwnershipAll, "/usr/local/lib", true},
+		{DirectoryOwnershipAll, "/usr/local/empty", true},
+	}
+
+	for _, test := range tests {
+		config := loadTestConfig(t, `
+prefix: "/usr/local"
+own_directories: "`+string(test.policy)+`"
+directories:
+  - path: "share"
+    recursive: true
+`)
+
+		owned := ownDirectory(config, test.path, nonEmptyDirs)
+		if owned != test.owned {
+			t.Errorf("%s, %q: got %t, expected %t",
+				test.policy, test.path, owned, test.owned)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/exograd/go-program"
+)
+
+func cmdCacheInfo(p *program.Program) {
+	cache := loadChecksumCache(p)
+
+	fmt.Printf("path: %s\n", cache.Path)
+	fmt.Printf("entries: %d\n", len(cache.Entries))
+
+	if p.IsOptionSet("list") {
+		for _, filePath := range cache.SortedPaths() {
+			fmt.Printf("%s  %s\n", cache.Entries[filePath].Sum, filePath)
+		}
+	}
+}
+
+func cmdCachePurge(p *program.Program) {
+	cache := loadChecksumCache(p)
+
+	if p.IsOptionSet("stale") {
+		n := cache.Prune()
+
+		if err := cache.Save(); err != nil {
+			p.Fatal("cannot save checksum cache: %v", err)
+		}
+
+		p.Info("%d stale entries removed", n)
+		return
+	}
+
+	if err := os.Remove(cache.Path); err != nil && !os.IsNotExist(err) {
+		p.Fatal("cannot delete %q: %v", cache.Path, err)
+	}
+
+	p.Info("%d entries removed", len(cache.Entries))
+}
+
+func checksumCachePath(p *program.Program) string {
+	if p.IsOptionSet("cache-file") {
+		return p.OptionValue("cache-file")
+	}
+
+	filePath, err := DefaultChecksumCachePath()
+	if err != nil {
+		p.Fatal("cannot locate checksum cache: %v", err)
+	}
+
+	return filePath
+}
+
+func loadChecksumCache(p *program.Program) *ChecksumCache {
+	filePath := checksumCachePath(p)
+
+	cache, err := LoadChecksumCache(filePath)
+	if err != nil {
+		p.Fatal("cannot load checksum cache: %v", err)
+	}
+
+	return cache
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Libpkg relies on libarchive to read packages and detects the compression
+// format from the content of the file, so all packages use the .pkg
+// extension whatever the format.
+
+type Compression string
+
+const (
+	CompressionNone  Compression = "none"
+	CompressionZstd  Compression = "zstd"
+	CompressionXz    Compression = "xz"
+	CompressionGzip  Compression = "gzip"
+	CompressionBzip2 Compression = "bzip2"
+)
+
+// A level of zero always selects the default level of the format.
+var compressionLevelRanges = map[Compression][2]int{
+	CompressionNone:  {0, 0},
+	CompressionZstd:  {1, 19},
+	CompressionXz:    {1, 9},
+	CompressionGzip:  {1, 9},
+	CompressionBzip2: {1, 9},
+}
+
+// Dictionary sizes used by xz(1) for each preset level. Other parameters of
+// xz presets are not supported by the encoder, so levels with the same
+// dictionary size are equivalent.
+var xzDictionarySizes = []int{
+	256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20,
+	8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20,
+}
+
+func (c Compression) ValidateLevel(level int) error {
+	levelRange, found := compressionLevelRanges[c]
+	if !found {
+		return fmt.Errorf("unknown compression format %q", c)
+	}
+
+	if level == 0 {
+		return nil
+	}
+
+	if c == CompressionNone {
+		return fmt.Errorf("cannot set a compression level without " +
+			"compression")
+	}
+
+	if level < levelRange[0] || level > levelRange[1] {
+		return fmt.Errorf("invalid compression level %d for format %q "+
+			"(must be between %d and %d)",
+			level, c, levelRange[0], levelRange[1])
+	}
+
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (w nopWriteCloser) Close() error {
+	return nil
+}
+
+// NewCompressionWriter returns a writer compressing data written to it
+// before writing it to w. Closing the returned writer flushes pending data
+// but does not close w.
+func NewCompressionWriter(w io.Writer, c Compression, level int) (io.WriteCloser, error) {
+	if err := c.ValidateLevel(level); err != nil {
+		return nil, err
+	}
+
+	switch c {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+
+	case CompressionZstd:
+		var options []zstd.EOption
+		if level != 0 {
+			// The encoder maps zstd levels to only four settings.
+			zlevel := zstd.EncoderLevelFromZstd(level)
+			options = append(options, zstd.WithEncoderLevel(zlevel))
+		}
+
+		return zstd.NewWriter(w, options...)
+
+	case CompressionXz:
+		var config xz.WriterConfig
+		if level != 0 {
+			config.DictCap = xzDictionarySizes[level]
+		}
+
+		return config.NewWriter(w)
+
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		return gzip.NewWriterLevel(w, level)
+
+	case CompressionBzip2:
+		return bzip2.NewWriter(w, &bzip2.WriterConfig{Level: level})
+	}
+
+	return nil, fmt.Errorf("unknown compression format %q", c)
+}
@@ -0,0 +1,384 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type ELFFile struct {
+	Machine elf.Machine
+	Class   elf.Class
+	Data    elf.Data
+	OSABI   elf.OSABI
+
+	// The value of __FreeBSD_version the file was built for, as found in the
+	// NT_FREEBSD_ABI_TAG note, or 0 if the file does not contain this note.
+	FreeBSDVersion uint32
+
+	// For ARM files, the value of the Tag_CPU_arch attribute found in the
+	// .ARM.attributes section, or 0 if there is no such attribute; 0 also
+	// designates architectures older than ARMv4, which FreeBSD does not
+	// support.
+	ARMCPUArch uint64
+
+	Needed []string
+	SOName string
+	RPaths []string
+}
+
+// IsFreeBSD reports whether the file was built for FreeBSD, either because
+// its header carries the FreeBSD OS ABI or because it contains a FreeBSD ABI
+// note.
+func (f *ELFFile) IsFreeBSD() bool {
+	return f.OSABI == elf.ELFOSABI_FREEBSD || f.FreeBSDVersion != 0
+}
+
+// NT_FREEBSD_ABI_TAG, see sys/sys/elf_common.h in the FreeBSD source tree.
+const ntFreeBSDABITag = 1
+
+// See the "Addenda to, and Errata in, the ABI for the Arm Architecture"
+// document for the format of build attributes.
+const (
+	armAttributesTagFile   = 1
+	armAttributeTagCPUArch = 6
+)
+
+// ReadELFFiles reads all ELF files built for FreeBSD among regular files in a
+// list of entries. The map returned is indexed by package path. As pkg does,
+// files built for other systems are ignored, and so are files which look like
+// ELF files but cannot be parsed.
+func ReadELFFiles(entries []*ChecksumEntry) (map[string]*ELFFile, error) {
+	elfFiles := make(map[string]*ELFFile)
+
+	for _, entry := range entries {
+		if !entry.Info.Mode().IsRegular() {
+			continue
+		}
+
+		elfFile, err := ReadELFFile(entry.FilePath)
+		if err != nil {
+			var invalidErr *InvalidELFFileError
+			if errors.As(err, &invalidErr) {
+				warn("ignoring %v", err)
+				continue
+			}
+
+			return nil, err
+		}
+
+		if elfFile != nil && elfFile.IsFreeBSD() {
+			elfFiles[entry.PackagePath] = elfFile
+		}
+	}
+
+	return elfFiles, nil
+}
+
+type InvalidELFFileError struct {
+	Path string
+	Err  error
+}
+
+func (err *InvalidELFFileError) Error() string {
+	return fmt.Sprintf("invalid ELF file %q: %v", err.Path, err.Err)
+}
+
+func (err *InvalidELFFileError) Unwrap() error {
+	return err.Err
+}
+
+// ReadELFFile reads an ELF file, returning nil if the file is not an ELF
+// file, or an InvalidELFFileError if it starts with the ELF magic number but
+// cannot be parsed.
+func ReadELFFile(filePath string) (*ELFFile, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %q: %w", filePath, err)
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+
+	if !bytes.Equal(magic, []byte(elf.ELFMAG)) {
+		return nil, nil
+	}
+
+	f, err := parseELFFile(file)
+	if err != nil {
+		return nil, &InvalidELFFileError{Path: filePath, Err: err}
+	}
+
+	return f, nil
+}
+
+func parseELFFile(file io.ReaderAt) (*ELFFile, error) {
+	elfFile, err := elf.NewFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer elfFile.Close()
+
+	f := ELFFile{
+		Machine: elfFile.Machine,
+		Class:   elfFile.Class,
+		Data:    elfFile.Data,
+		OSABI:   elfFile.OSABI,
+	}
+
+	f.FreeBSDVersion, err = readFreeBSDVersion(elfFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read notes: %w", err)
+	}
+
+	if f.Machine == elf.EM_ARM {
+		f.ARMCPUArch, err = readARMCPUArch(elfFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read ARM attributes: %w", err)
+		}
+	}
+
+	// Files without dynamic section (static executables, object files)
+	// have neither dependencies nor soname.
+	if elfFile.Section(".dynamic") == nil {
+		return &f, nil
+	}
+
+	f.Needed, err = elfFile.DynString(elf.DT_NEEDED)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read dependencies: %w", err)
+	}
+
+	sonames, err := elfFile.DynString(elf.DT_SONAME)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read soname: %w", err)
+	}
+
+	if len(sonames) > 0 {
+		f.SOName = sonames[0]
+	}
+
+	for _, tag := range []elf.DynTag{elf.DT_RPATH, elf.DT_RUNPATH} {
+		values, err := elfFile.DynString(tag)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read library search path: %w",
+				err)
+		}
+
+		for _, value := range values {
+			f.RPaths = append(f.RPaths, strings.Split(value, ":")...)
+		}
+	}
+
+	return &f, nil
+}
+
+func readFreeBSDVersion(elfFile *elf.File) (uint32, error) {
+	for _, prog := range elfFile.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+
+		data, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return 0, err
+		}
+
+		if version, found := findFreeBSDVersion(data, elfFile.ByteOrder); found {
+			return version, nil
+		}
+	}
+
+	// Relocatable files do not have program headers.
+	for _, section := range elfFile.Sections {
+		if section.Type != elf.SHT_NOTE {
+			continue
+		}
+
+		data, err := section.Data()
+		if err != nil {
+			return 0, err
+		}
+
+		if version, found := findFreeBSDVersion(data, elfFile.ByteOrder); found {
+			return version, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func findFreeBSDVersion(data []byte, byteOrder binary.ByteOrder) (uint32, bool) {
+	// Sizes are handled as 64 bit integers so that aligning them cannot
+	// overflow.
+	align4 := func(n uint64) uint64 {
+		return (n + 3) &^ 3
+	}
+
+	for len(data) >= 12 {
+		nameSize := uint64(byteOrder.Uint32(data[0:4]))
+		descSize := uint64(byteOrder.Uint32(data[4:8]))
+		noteType := byteOrder.Uint32(data[8:12])
+		data = data[12:]
+
+		size := uint64(len(data))
+		if nameSize > size || align4(nameSize)+descSize > size {
+			break
+		}
+
+		name := data[:nameSize]
+		desc := data[align4(nameSize) : align4(nameSize)+descSize]
+
+		// The padding of the last note may be missing.
+		end := align4(nameSize) + align4(descSize)
+		if end > size {
+			end = size
+		}
+		data = data[end:]
+
+		if string(bytes.TrimRight(name, "\x00")) == "FreeBSD" &&
+			noteType == ntFreeBSDABITag && len(desc) == 4 {
+			return byteOrder.Uint32(desc), true
+		}
+	}
+
+	return 0, false
+}
+
+func readARMCPUArch(elfFile *elf.File) (uint64, error) {
+	section := elfFile.Section(".ARM.attributes")
+	if section == nil {
+		return 0, nil
+	}
+
+	data, err := section.Data()
+	if err != nil {
+		return 0, err
+	}
+
+	arch, _ := findARMCPUArch(data, elfFile.ByteOrder)
+	return arch, nil
+}
+
+func findARMCPUArch(data []byte, byteOrder binary.ByteOrder) (uint64, bool) {
+	if len(data) == 0 || data[0] != 'A' {
+		return 0, false
+	}
+	data = data[1:]
+
+	for len(data) >= 4 {
+		size := uint64(byteOrder.Uint32(data[0:4]))
+		if size < 4 || size > uint64(len(data)) {
+			break
+		}
+
+		subsection := data[4:size]
+		data = data[size:]
+
+		// Attributes of other vendors do not contain the architecture.
+		end := bytes.IndexByte(subsection, 0)
+		if end < 0 || string(subsection[:end]) != "aeabi" {
+			continue
+		}
+		subsection = subsection[end+1:]
+
+		for len(subsection) > 0 {
+			tag, n := binary.Uvarint(subsection)
+			if n <= 0 || len(subsection) < n+4 {
+				break
+			}
+
+			size := uint64(byteOrder.Uint32(subsection[n : n+4]))
+			if size < uint64(n+4) || size > uint64(len(subsection)) {
+				break
+			}
+
+			attributes := subsection[n+4 : size]
+			subsection = subsection[size:]
+
+			// Section and symbol attributes only apply to part of the file.
+			if tag != armAttributesTagFile {
+				continue
+			}
+
+			if arch, found := findARMAttribute(attributes); found {
+				return arch, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func findARMAttribute(data []byte) (uint64, bool) {
+	skipString := func() bool {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return false
+		}
+
+		data = data[end+1:]
+		return true
+	}
+
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			break
+		}
+		data = data[n:]
+
+		// Tag_CPU_raw_name (4), Tag_CPU_name (5) and attributes with odd
+		// tags above 32 are null-terminated strings; other attributes are
+		// integers, followed by a string for Tag_compatibility (32).
+		if tag == 4 || tag == 5 || (tag > 32 && tag%2 == 1) {
+			if !skipString() {
+				break
+			}
+
+			continue
+		}
+
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			break
+		}
+		data = data[n:]
+
+		if tag == armAttributeTagCPUArch {
+			return value, true
+		}
+
+		if tag == 32 && !skipString() {
+			break
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func appendUint32(data []byte, byteOrder binary.ByteOrder, n uint32) []byte {
+	buf := make([]byte, 4)
+	byteOrder.PutUint32(buf, n)
+	return append(data, buf...)
+}
+
+func elfNote(byteOrder binary.ByteOrder, name string, noteType uint32, desc []byte) []byte {
+	var data []byte
+
+	data = appendUint32(data, byteOrder, uint32(len(name)))
+	data = appendUint32(data, byteOrder, uint32(len(desc)))
+	data = appendUint32(data, byteOrder, noteType)
+
+	data = append(data, name...)
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+
+	data = append(data, desc...)
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+
+	return data
+}
+
+func TestFindFreeBSDVersion(t *testing.T) {
+	le := binary.LittleEndian
+	be := binary.BigEndian
+
+	version := appendUint32(nil, le, 1302001)
+	versionBE := appendUint32(nil, be, 1302001)
+
+	concat := func(notes ...[]byte) []byte {
+		var data []byte
+		for _, note := range notes {
+			data = append(data, note...)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		byteOrder binary.ByteOrder
+		version   uint32
+		found     bool
+	}{
+		{"empty", nil, le, 0, false},
+		{"abi tag",
+			elfNote(le, "FreeBSD\x00", ntFreeBSDABITag, version),
+			le, 1302001, true},
+		{"big endian abi tag",
+			elfNote(be, "FreeBSD\x00", ntFreeBSDABITag, versionBE),
+			be, 1302001, true},
+		{"after other notes",
+			concat(elfNote(le, "GNU\x00", 3, []byte{1, 2, 3, 4, 5}),
+				elfNote(le, "FreeBSD\x00", 4, []byte{0, 0, 0, 0}),
+				elfNote(le, "FreeBSD\x00", ntFreeBSDABITag, version)),
+			le, 1302001, true},
+		{"other vendor",
+			elfNote(le, "NetBSD\x00", ntFreeBSDABITag, version),
+			le, 0, false},
+		{"invalid descriptor size",
+			elfNote(le, "FreeBSD\x00", ntFreeBSDABITag, []byte{1, 2}),
+			le, 0, false},
+		{"truncated note",
+			elfNote(le, "FreeBSD\x00", ntFreeBSDABITag, version)[:16],
+			le, 0, false},
+		{"huge name size",
+			[]byte{0xfe, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0},
+			le, 0, false},
+		{"huge descriptor size",
+			[]byte{8, 0, 0, 0, 0xfe, 0xff, 0xff, 0xff, 1, 0, 0, 0,
+				'F', 'r', 'e', 'e', 'B', 'S', 'D', 0},
+			le, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version, found := findFreeBSDVersion(test.data, test.byteOrder)
+			if version != test.version || found != test.found {
+				t.Errorf("got (%d, %t), expected (%d, %t)",
+					version, found, test.version, test.found)
+			}
+		})
+	}
+}
+
+func armAttributes(byteOrder binary.ByteOrder, vendor string, tag byte, attributes []byte) []byte {
+	var subsection []byte
+	subsection = append(subsection, tag)
+	subsection = appendUint32(subsection, byteOrder, uint32(len(attributes)+5))
+	subsection = append(subsection, attributes...)
+
+	var data []byte
+	data = appendUint32(data, byteOrder,
+		uint32(4+len(vendor)+1+len(subsection)))
+	data = append(data, vendor...)
+	data = append(data, 0)
+	data = append(data, subsection...)
+
+	return data
+}
+
+func TestFindARMCPUArch(t *testing.T) {
+	le := binary.LittleEndian
+	be := binary.BigEndian
+
+	armv6 := []byte{5, 'A', 'R', 'M', 'v', '6', 0, 6, 6, 8, 1}
+	armv7 := []byte{4, 'c', 'o', 'r', 't', 'e', 'x', 0, 32, 1, 'x', 0,
+		5, '7', '-', 'A', 0, 6, 10, 7, 'A'}
+
+	concat := func(parts ...[]byte) []byte {
+		data := []byte{'A'}
+		for _, part := range parts {
+			data = append(data, part...)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		byteOrder binary.ByteOrder
+		arch      uint64
+		found     bool
+	}{
+		{"empty", nil, le, 0, false},
+		{"armv6", concat(armAttributes(le, "aeabi", 1, armv6)), le, 6, true},
+		{"armv7", concat(armAttributes(le, "aeabi", 1, armv7)), le, 10, true},
+		{"big endian",
+			concat(armAttributes(be, "aeabi", 1, armv7)), be, 10, true},
+		{"after other vendors",
+			concat(armAttributes(le, "gnu", 1, []byte{6, 6}),
+				armAttributes(le, "aeabi", 1, armv7)),
+			le, 10, true},
+		{"section attributes",
+			concat(armAttributes(le, "aeabi", 2, armv7)), le, 0, false},
+		{"invalid format version",
+			append([]byte{'B'}, armAttributes(le, "aeabi", 1, armv7)...),
+			le, 0, false},
+		{"missing attribute",
+			concat(armAttributes(le, "aeabi", 1, []byte{8, 1})), le, 0, false},
+		{"truncated string",
+			concat(armAttributes(le, "aeabi", 1, []byte{5, 'A'})),
+			le, 0, false},
+		{"truncated subsection",
+			concat(armAttributes(le, "aeabi", 1, armv7))[:12], le, 0, false},
+		{"huge subsection size",
+			[]byte{'A', 0xfe, 0xff, 0xff, 0xff, 'a', 'e', 'a', 'b', 'i', 0},
+			le, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			arch, found := findARMCPUArch(test.data, test.byteOrder)
+			if arch != test.arch || found != test.found {
+				t.Errorf("got (%d, %t), expected (%d, %t)",
+					arch, found, test.arch, test.found)
+			}
+		})
+	}
+}
@@ -15,6 +15,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/exograd/go-program"
 )
 
@@ -31,7 +34,39 @@ func main() {
 		"the path of the configuration file")
 	c.AddOption("v", "version", "string", "",
 		"set the version of the package")
+	c.AddOption("", "compression", "format", "",
+		"the compression format (none, zstd, xz, gzip or bzip2)")
+	c.AddOption("", "compression-level", "level", "",
+		"the compression level")
+	c.AddOption("e", "exclude", "patterns", "",
+		"a comma-separated list of glob patterns of files to ignore")
+	c.AddOption("j", "jobs", "count", "",
+		"the number of files to process in parallel")
+	c.AddOption("", "timestamp", "time", "",
+		"the modification time of all archive entries")
+
+	c.AddFlag("", "cache",
+		"use the checksum cache")
+	c.AddOption("", "cache-file", "path", "",
+		"the path of the checksum cache")
+
+	c = p.AddCommand("cache-info", "print information about the checksum cache",
+		cmdCacheInfo)
+	c.AddFlag("l", "list",
+		"list all cached checksums")
+	c.AddOption("", "cache-file", "path", "",
+		"the path of the checksum cache")
+
+	c = p.AddCommand("cache-purge", "delete cached checksums", cmdCachePurge)
+	c.AddFlag("", "stale",
+		"only delete checksums of files which have changed or been deleted")
+	c.AddOption("", "cache-file", "path", "",
+		"the path of the checksum cache")
 
 	p.ParseCommandLine()
 	p.Run()
 }
+
+func warn(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
+}
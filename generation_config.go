@@ -18,29 +18,91 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"path"
 	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type GenerationConfig struct {
-	Name             string                       `yaml:"name"`
-	Version          string                       `yaml:"version,omitempty"`
-	ShortDescription string                       `yaml:"short_description,omitempty"`
-	LongDescription  string                       `yaml:"long_description,omitempty"`
-	WebsiteURI       string                       `yaml:"website_uri"`
-	Maintainer       string                       `yaml:"maintainer"`
-	Origin           string                       `yaml:"origin,omitempty"`
-	Architecture     string                       `yaml:"architecture,omitempty"`
-	Dependencies     []GenerationConfigDependency `yaml:"dependencies,omitempty"`
-	Users            []GenerationConfigUser       `yaml:"users,omitempty"`
-	Groups           []GenerationConfigGroup      `yaml:"groups,omitempty"`
-	FileOwner        string                       `yaml:"file_owner,omitempty"`
-	FileGroup        string                       `yaml:"file_group,omitempty"`
-	Files            []GenerationConfigFile       `yaml:"files,omitempty"`
-	Directories      []GenerationConfigDirectory  `yaml:"directories,omitempty"`
+	Name             string                            `yaml:"name"`
+	Version          string                            `yaml:"version,omitempty"`
+	ShortDescription string                            `yaml:"short_description,omitempty"`
+	LongDescription  string                            `yaml:"long_description,omitempty"`
+	WebsiteURI       string                            `yaml:"website_uri"`
+	Maintainer       string                            `yaml:"maintainer"`
+	Origin           string                            `yaml:"origin,omitempty"`
+	Prefix           string                            `yaml:"prefix,omitempty"`
+	Architecture     string                            `yaml:"architecture,omitempty"`
+	LicenseLogic     string                            `yaml:"license_logic,omitempty"`
+	Licenses         []string                          `yaml:"licenses,omitempty"`
+	Categories       []string                          `yaml:"categories,omitempty"`
+	Annotations      map[string]string                 `yaml:"annotations,omitempty"`
+	Options          map[string]bool                   `yaml:"options,omitempty"`
+	Vital            bool                              `yaml:"vital,omitempty"`
+	DetectABI        bool                              `yaml:"detect_abi"`
+	DetectShlibs     bool                              `yaml:"detect_shlibs"`
+	ShlibsRequired   []string                          `yaml:"shlibs_required,omitempty"`
+	ShlibsProvided   []string                          `yaml:"shlibs_provided,omitempty"`
+	ShlibsIgnore     []string                          `yaml:"shlibs_ignore,omitempty"`
+	Dependencies     []GenerationConfigDependency      `yaml:"dependencies,omitempty"`
+	Provides         []string                          `yaml:"provides,omitempty"`
+	Requires         []string                          `yaml:"requires,omitempty"`
+	Conflicts        []string                          `yaml:"conflicts,omitempty"`
+	Messages         []GenerationConfigMessage         `yaml:"messages,omitempty"`
+	Scripts          map[string]GenerationConfigScript `yaml:"scripts,omitempty"`
+	LuaScripts       map[string]GenerationConfigScript `yaml:"lua_scripts,omitempty"`
+	CheckLuaScripts  bool                              `yaml:"check_lua_scripts"`
+	Users            []GenerationConfigUser            `yaml:"users,omitempty"`
+	Groups           []GenerationConfigGroup           `yaml:"groups,omitempty"`
+	FileOwner        string                            `yaml:"file_owner,omitempty"`
+	FileGroup        string                            `yaml:"file_group,omitempty"`
+	Files            []GenerationConfigFile            `yaml:"files,omitempty"`
+	Directories      []GenerationConfigDirectory       `yaml:"directories,omitempty"`
+	OwnDirectories   DirectoryOwnership                `yaml:"own_directories,omitempty"`
+	Sources          []GenerationConfigSource          `yaml:"sources,omitempty"`
+	Exclude          []GenerationConfigPattern         `yaml:"exclude,omitempty"`
+	Include          []GenerationConfigPattern         `yaml:"include,omitempty"`
+	Compression      Compression                       `yaml:"compression,omitempty"`
+	CompressionLevel int                               `yaml:"compression_level,omitempty"`
+	Symlinks         SymlinkPolicy                     `yaml:"symlinks,omitempty"`
+	TimestampString  string                            `yaml:"timestamp,omitempty"`
+	Timestamp        *time.Time                        `yaml:"-"`
+	Jobs             int                               `yaml:"jobs,omitempty"`
+	UserIDs          map[string]int                    `yaml:"user_ids,omitempty"`
+	GroupIDs         map[string]int                    `yaml:"group_ids,omitempty"`
 }
 
+// The directory ownership policy controls which directories found in sources
+// are registered in the package, and are therefore deleted when the package
+// is removed. Directories listed in the configuration, and directories below
+// recursive directory rules, are always registered.
+type DirectoryOwnership string
+
+const (
+	// No directory found in sources, except for directories below
+	// recursive directory rules.
+	DirectoryOwnershipNone DirectoryOwnership = "none"
+	// Empty directories, and directories matched by a directory rule.
+	DirectoryOwnershipEmpty DirectoryOwnership = "empty"
+	// All directories found in sources.
+	DirectoryOwnershipAll DirectoryOwnership = "all"
+	// Directories matched by a directory rule, including directories below
+	// recursive directory rules.
+	DirectoryOwnershipListed DirectoryOwnership = "listed"
+)
+
+type SymlinkPolicy string
+
+const (
+	SymlinkPolicyPreserve SymlinkPolicy = "preserve"
+	SymlinkPolicyFollow   SymlinkPolicy = "follow"
+)
+
 type GenerationConfigDependency struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
@@ -57,26 +119,86 @@ type GenerationConfigGroup struct {
 	GID  uint   `yaml:"gid"`
 }
 
+// File rules select files either by exact path, glob pattern or regular
+// expression. All rules matching a file are applied in order, so that a rule
+// can override attributes set by previous ones.
 type GenerationConfigFile struct {
 	Path             string `yaml:"path,omitempty"`
+	PathGlob         string `yaml:"path_glob,omitempty"`
 	PathRegexpString string `yaml:"path_regexp,omitempty"`
 	PathRegexp       *regexp.Regexp
 	Mode             string `yaml:"mode,omitempty"`
 	Owner            string `yaml:"owner,omitempty"`
 	Group            string `yaml:"group,omitempty"`
+	Config           bool   `yaml:"config,omitempty"`
+}
+
+// Scripts are either written as a string containing the content of the
+// script, or as an object containing the path of a file relative to the
+// configuration file.
+type GenerationConfigScript struct {
+	Content string `yaml:"content,omitempty"`
+	File    string `yaml:"file,omitempty"`
+}
+
+var scriptPhases = []string{
+	"pre-install",
+	"post-install",
+	"pre-deinstall",
+	"post-deinstall",
 }
 
+// Messages are displayed by pkg when the package is installed, upgraded or
+// removed. Version constraints only apply to upgrade messages and refer to
+// the version of the package being upgraded.
+type GenerationConfigMessage struct {
+	Message        string `yaml:"message"`
+	Type           string `yaml:"type,omitempty"`
+	MinimumVersion string `yaml:"minimum_version,omitempty"`
+	MaximumVersion string `yaml:"maximum_version,omitempty"`
+}
+
+// A source is either a file or a directory on the local system. Directories
+// are copied recursively in the package.
+type GenerationConfigSource struct {
+	Path        string `yaml:"path"`
+	Destination string `yaml:"destination"`
+}
+
+// Patterns are either written as a string containing a glob pattern, or as an
+// object containing either a glob pattern or a regular expression.
+type GenerationConfigPattern struct {
+	Glob         string         `yaml:"glob,omitempty"`
+	RegexpString string         `yaml:"regexp,omitempty"`
+	Regexp       *regexp.Regexp `yaml:"-"`
+}
+
+// Recursive directory rules also apply to all files and directories found
+// below the directory: Mode applies to directories and FileMode to files.
 type GenerationConfigDirectory struct {
-	Path  string `yaml:"path,omitempty"`
-	Mode  string `yaml:"mode,omitempty"`
-	Owner string `yaml:"owner,omitempty"`
-	Group string `yaml:"group,omitempty"`
+	Path      string `yaml:"path,omitempty"`
+	Mode      string `yaml:"mode,omitempty"`
+	Owner     string `yaml:"owner,omitempty"`
+	Group     string `yaml:"group,omitempty"`
+	Recursive bool   `yaml:"recursive,omitempty"`
+	FileMode  string `yaml:"file_mode,omitempty"`
 }
 
 func DefaultGenerationConfig() *GenerationConfig {
 	return &GenerationConfig{
+		Prefix:    "/",
 		FileOwner: "root",
 		FileGroup: "wheel",
+
+		OwnDirectories: DirectoryOwnershipListed,
+		DetectABI:      true,
+		DetectShlibs:   true,
+
+		CheckLuaScripts: true,
+
+		Compression: CompressionZstd,
+		Symlinks:    SymlinkPolicyPreserve,
+		Jobs:        runtime.NumCPU(),
 	}
 }
 
@@ -104,6 +226,125 @@ func (pc *GenerationConfig) UnmarshalYAML(value *yaml.Node) error {
 		return fmt.Errorf("missing or empty maintainer")
 	}
 
+	switch c.LicenseLogic {
+	case "":
+		if len(c.Licenses) > 1 {
+			return fmt.Errorf("missing license logic for multiple licenses")
+		}
+
+	case "single":
+		if len(c.Licenses) > 1 {
+			return fmt.Errorf("invalid license logic %q for multiple "+
+				"licenses", c.LicenseLogic)
+		}
+
+	case "or", "and":
+
+	default:
+		return fmt.Errorf("invalid license logic %q", c.LicenseLogic)
+	}
+
+	// Conflicts are matched by pkg with fnmatch(3) against package names
+	// and origins.
+	for _, pattern := range c.Conflicts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid conflict pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, pattern := range c.ShlibsIgnore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid shared library pattern %q: %w",
+				pattern, err)
+		}
+	}
+
+	for phase := range c.Scripts {
+		if !isScriptPhase(phase) {
+			return fmt.Errorf("invalid script phase %q", phase)
+		}
+	}
+
+	for phase := range c.LuaScripts {
+		if !isScriptPhase(phase) {
+			return fmt.Errorf("invalid lua script phase %q", phase)
+		}
+	}
+
+	if !path.IsAbs(c.Prefix) {
+		return fmt.Errorf("prefix %q is not an absolute path", c.Prefix)
+	}
+	c.Prefix = path.Clean(c.Prefix)
+
+	// Relative paths in file and directory rules are relative to the prefix.
+	for i := range c.Files {
+		file := &c.Files[i]
+		if file.Path != "" && !path.IsAbs(file.Path) {
+			file.Path = path.Join(c.Prefix, file.Path)
+		}
+
+		if file.PathGlob != "" && !path.IsAbs(file.PathGlob) {
+			file.PathGlob = path.Join(c.Prefix, file.PathGlob)
+		}
+	}
+
+	for i := range c.Directories {
+		dir := &c.Directories[i]
+		if !path.IsAbs(dir.Path) {
+			dir.Path = path.Join(c.Prefix, dir.Path)
+		}
+	}
+
+	for i := range c.Sources {
+		source := &c.Sources[i]
+		if !path.IsAbs(source.Destination) {
+			source.Destination = path.Join(c.Prefix, source.Destination)
+		}
+	}
+
+	if err := c.Compression.ValidateLevel(c.CompressionLevel); err != nil {
+		return err
+	}
+
+	if c.Jobs < 1 {
+		return fmt.Errorf("invalid number of jobs %d", c.Jobs)
+	}
+
+	if c.TimestampString != "" {
+		timestamp, err := parseTimestamp(c.TimestampString)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q: %w", c.TimestampString, err)
+		}
+
+		c.Timestamp = &timestamp
+	}
+
+	switch c.OwnDirectories {
+	case DirectoryOwnershipNone, DirectoryOwnershipEmpty,
+		DirectoryOwnershipAll, DirectoryOwnershipListed:
+	default:
+		return fmt.Errorf("invalid directory ownership policy %q",
+			c.OwnDirectories)
+	}
+
+	switch c.Symlinks {
+	case SymlinkPolicyPreserve, SymlinkPolicyFollow:
+	default:
+		return fmt.Errorf("invalid symlink policy %q", c.Symlinks)
+	}
+
+	for name, id := range c.UserIDs {
+		if id < 0 {
+			return fmt.Errorf("invalid id %d for user %q", id, name)
+		}
+	}
+
+	for name, id := range c.GroupIDs {
+		if id < 0 {
+			return fmt.Errorf("invalid id %d for group %q", id, name)
+		}
+	}
+
 	*pc = GenerationConfig(c)
 	return nil
 }
@@ -160,12 +401,27 @@ func (pc *GenerationConfigFile) UnmarshalYAML(value *yaml.Node) error {
 		return err
 	}
 
-	if c.Path == "" && c.PathRegexpString == "" {
-		return fmt.Errorf("missing or empty file path or file path regexp")
+	nbSelectors := 0
+	for _, s := range []string{c.Path, c.PathGlob, c.PathRegexpString} {
+		if s != "" {
+			nbSelectors++
+		}
 	}
 
-	if c.Path != "" && c.PathRegexpString != "" {
-		return fmt.Errorf("cannot set both file path and file path regexp")
+	if nbSelectors == 0 {
+		return fmt.Errorf("missing or empty file path, file path glob " +
+			"pattern or file path regexp")
+	}
+
+	if nbSelectors > 1 {
+		return fmt.Errorf("cannot set more than one of file path, " +
+			"file path glob pattern and file path regexp")
+	}
+
+	if c.PathGlob != "" {
+		if err := ValidateGlob(c.PathGlob); err != nil {
+			return err
+		}
 	}
 
 	if s := c.PathRegexpString; s != "" {
@@ -177,10 +433,185 @@ func (pc *GenerationConfigFile) UnmarshalYAML(value *yaml.Node) error {
 		c.PathRegexp = re
 	}
 
+	if c.Mode != "" {
+		if err := validateMode(c.Mode); err != nil {
+			return err
+		}
+	}
+
 	*pc = GenerationConfigFile(c)
 	return nil
 }
 
+func (pc *GenerationConfigDirectory) UnmarshalYAML(value *yaml.Node) error {
+	type GenerationConfigDirectory2 GenerationConfigDirectory
+	c := GenerationConfigDirectory2(*pc)
+
+	if err := value.Decode(&c); err != nil {
+		return err
+	}
+
+	if c.Path == "" {
+		return fmt.Errorf("missing or empty directory path")
+	}
+
+	if c.Mode != "" {
+		if err := validateMode(c.Mode); err != nil {
+			return err
+		}
+	}
+
+	if c.FileMode != "" {
+		if !c.Recursive {
+			return fmt.Errorf("cannot set a file mode for a non-recursive " +
+				"directory")
+		}
+
+		if err := validateMode(c.FileMode); err != nil {
+			return err
+		}
+	}
+
+	*pc = GenerationConfigDirectory(c)
+	return nil
+}
+
+// validateMode checks that a mode is an octal number containing permission
+// bits, optionally with the setuid (4000), setgid (2000) and sticky (1000)
+// bits.
+func validateMode(s string) error {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 07777 {
+		return fmt.Errorf("invalid mode %q", s)
+	}
+
+	return nil
+}
+
+func (pc *GenerationConfigScript) UnmarshalYAML(value *yaml.Node) error {
+	type GenerationConfigScript2 GenerationConfigScript
+	c := GenerationConfigScript2(*pc)
+
+	if value.Kind == yaml.ScalarNode {
+		if err := value.Decode(&c.Content); err != nil {
+			return err
+		}
+	} else {
+		if err := value.Decode(&c); err != nil {
+			return err
+		}
+
+		if c.Content == "" && c.File == "" {
+			return fmt.Errorf("missing or empty script content or file")
+		}
+
+		if c.Content != "" && c.File != "" {
+			return fmt.Errorf("cannot set both script content and file")
+		}
+	}
+
+	*pc = GenerationConfigScript(c)
+	return nil
+}
+
+func (pc *GenerationConfigMessage) UnmarshalYAML(value *yaml.Node) error {
+	type GenerationConfigMessage2 GenerationConfigMessage
+	c := GenerationConfigMessage2(*pc)
+
+	if err := value.Decode(&c); err != nil {
+		return err
+	}
+
+	if c.Message == "" {
+		return fmt.Errorf("missing or empty message")
+	}
+
+	switch c.Type {
+	case "", "always", "install", "remove", "upgrade":
+	default:
+		return fmt.Errorf("invalid message type %q", c.Type)
+	}
+
+	hasVersions := c.MinimumVersion != "" || c.MaximumVersion != ""
+	if hasVersions && c.Type != "upgrade" {
+		return fmt.Errorf("version constraints can only be set for " +
+			"upgrade messages")
+	}
+
+	*pc = GenerationConfigMessage(c)
+	return nil
+}
+
+func (pc *GenerationConfigSource) UnmarshalYAML(value *yaml.Node) error {
+	type GenerationConfigSource2 GenerationConfigSource
+	c := GenerationConfigSource2(*pc)
+
+	if err := value.Decode(&c); err != nil {
+		return err
+	}
+
+	if c.Path == "" {
+		return fmt.Errorf("missing or empty source path")
+	}
+
+	if c.Destination == "" {
+		return fmt.Errorf("missing or empty source destination")
+	}
+
+	*pc = GenerationConfigSource(c)
+	return nil
+}
+
+func (pc *GenerationConfigPattern) UnmarshalYAML(value *yaml.Node) error {
+	type GenerationConfigPattern2 GenerationConfigPattern
+	c := GenerationConfigPattern2(*pc)
+
+	if value.Kind == yaml.ScalarNode {
+		if err := value.Decode(&c.Glob); err != nil {
+			return err
+		}
+	} else {
+		if err := value.Decode(&c); err != nil {
+			return err
+		}
+	}
+
+	p := GenerationConfigPattern(c)
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	*pc = p
+	return nil
+}
+
+func (p *GenerationConfigPattern) Validate() error {
+	if p.Glob == "" && p.RegexpString == "" {
+		return fmt.Errorf("missing or empty glob pattern or regexp")
+	}
+
+	if p.Glob != "" && p.RegexpString != "" {
+		return fmt.Errorf("cannot set both glob pattern and regexp")
+	}
+
+	if p.Glob != "" {
+		if err := ValidateGlob(p.Glob); err != nil {
+			return err
+		}
+	}
+
+	if s := p.RegexpString; s != "" {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return fmt.Errorf("invalid regexp %q: %w", s, err)
+		}
+
+		p.Regexp = re
+	}
+
+	return nil
+}
+
 func (c *GenerationConfig) LoadFile(filePath string) error {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -193,23 +624,297 @@ func (c *GenerationConfig) LoadFile(filePath string) error {
 		return fmt.Errorf("cannot decode configuration: %w", err)
 	}
 
+	// Source paths are relative to the configuration file.
+	for i := range c.Sources {
+		source := &c.Sources[i]
+		if !path.IsAbs(source.Path) {
+			source.Path = path.Join(path.Dir(filePath), source.Path)
+		}
+	}
+
+	dirPath := path.Dir(filePath)
+
+	if err := loadScriptFiles(c.Scripts, dirPath); err != nil {
+		return err
+	}
+
+	if err := loadScriptFiles(c.LuaScripts, dirPath); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+func loadScriptFiles(scripts map[string]GenerationConfigScript, dirPath string) error {
+	for phase, script := range scripts {
+		if script.File == "" {
+			continue
+		}
+
+		scriptPath := script.File
+		if !path.IsAbs(scriptPath) {
+			scriptPath = path.Join(dirPath, scriptPath)
+		}
+
+		data, err := os.ReadFile(scriptPath)
+		if err != nil {
+			return fmt.Errorf("cannot read %s script: %w", phase, err)
+		}
+
+		script.Content = string(data)
+		scripts[phase] = script
+	}
+
+	return nil
+}
+
+// Users and groups of the FreeBSD base system, as found in etc/master.passwd
+// and etc/group in the FreeBSD source tree. Ids of other accounts are either
+// found in the users and groups created by the package or set in the
+// configuration.
+var baseSystemUserIDs = map[string]int{
+	"root":       0,
+	"toor":       0,
+	"daemon":     1,
+	"operator":   2,
+	"bin":        3,
+	"tty":        4,
+	"kmem":       5,
+	"games":      7,
+	"news":       8,
+	"man":        9,
+	"sshd":       22,
+	"smmsp":      25,
+	"mailnull":   26,
+	"bind":       53,
+	"unbound":    59,
+	"proxy":      62,
+	"_pflogd":    64,
+	"_dhcp":      65,
+	"uucp":       66,
+	"pop":        68,
+	"auditdistd": 78,
+	"www":        80,
+	"ntpd":       123,
+	"_ypldap":    160,
+	"hast":       845,
+	"tests":      977,
+	"nobody":     65534,
+}
+
+var baseSystemGroupIDs = map[string]int{
+	"wheel":    0,
+	"daemon":   1,
+	"kmem":     2,
+	"sys":      3,
+	"tty":      4,
+	"operator": 5,
+	"mail":     6,
+	"bin":      7,
+	"news":     8,
+	"man":      9,
+	"games":    13,
+	"ftp":      14,
+	"staff":    20,
+	"sshd":     22,
+	"smmsp":    25,
+	"mailnull": 26,
+	"guest":    31,
+	"video":    44,
+	"realtime": 47,
+	"bind":     53,
+	"unbound":  59,
+	"proxy":    62,
+	"authpf":   63,
+	"_pflogd":  64,
+	"_dhcp":    65,
+	"uucp":     66,
+	"dialer":   68,
+	"network":  69,
+	"audit":    77,
+	"www":      80,
+	"ntpd":     123,
+	"_ypldap":  160,
+	"hast":     845,
+	"tests":    977,
+	"nogroup":  65533,
+	"nobody":   65534,
+}
+
+func isScriptPhase(phase string) bool {
+	for _, phase2 := range scriptPhases {
+		if phase == phase2 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IgnoreShlib returns true if a shared library matches one of the patterns
+// of the shlibs_ignore setting.
+func (c *GenerationConfig) IgnoreShlib(name string) bool {
+	for _, pattern := range c.ShlibsIgnore {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UserID returns the numeric id of a user, or 0 and false if the user is
+// unknown.
+func (c *GenerationConfig) UserID(name string) (int, bool) {
+	if id, found := c.UserIDs[name]; found {
+		return id, true
+	}
+
+	for _, user := range c.Users {
+		if user.Name == name {
+			return int(user.UID), true
+		}
+	}
+
+	id, found := baseSystemUserIDs[name]
+	return id, found
+}
+
+// GroupID returns the numeric id of a group, or 0 and false if the group is
+// unknown.
+func (c *GenerationConfig) GroupID(name string) (int, bool) {
+	if id, found := c.GroupIDs[name]; found {
+		return id, true
+	}
+
+	for _, group := range c.Groups {
+		if group.Name == name {
+			return int(group.GID), true
+		}
+	}
+
+	id, found := baseSystemGroupIDs[name]
+	return id, found
+}
+
+// FindFile returns the attributes set for a file by recursive directory rules
+// and matching file rules. Directory rules are applied first, then file
+// rules; in each group, rules are applied in the order they are declared, so
+// that when several rules set the same attribute, the last one wins.
 func (c *GenerationConfig) FindFile(filePath string) (GenerationConfigFile, bool) {
+	var result GenerationConfigFile
+	found := false
+
+	for _, dir := range c.Directories {
+		if !dir.Recursive || !isSubpath(filePath, dir.Path) {
+			continue
+		}
+
+		found = true
+
+		if dir.FileMode != "" {
+			result.Mode = dir.FileMode
+		}
+
+		if dir.Owner != "" {
+			result.Owner = dir.Owner
+		}
+
+		if dir.Group != "" {
+			result.Group = dir.Group
+		}
+	}
+
 	for _, file := range c.Files {
-		switch {
-		case file.Path != "":
-			if file.Path == filePath {
-				return file, true
-			}
+		if !file.Match(filePath) {
+			continue
+		}
+
+		found = true
 
-		case file.PathRegexp != nil:
-			if file.PathRegexp.MatchString(filePath) {
-				return file, true
-			}
+		if file.Mode != "" {
+			result.Mode = file.Mode
 		}
+
+		if file.Owner != "" {
+			result.Owner = file.Owner
+		}
+
+		if file.Group != "" {
+			result.Group = file.Group
+		}
+
+		if file.Config {
+			result.Config = true
+		}
+	}
+
+	return result, found
+}
+
+// FindDirectory returns the attributes set for a directory by directory rules
+// matching either the directory itself or, for recursive rules, one of its
+// parent directories. Rules are applied in the order they are declared.
+func (c *GenerationConfig) FindDirectory(dirPath string) (GenerationConfigDirectory, bool) {
+	var result GenerationConfigDirectory
+	found := false
+
+	for _, dir := range c.Directories {
+		if dir.Path != dirPath &&
+			!(dir.Recursive && isSubpath(dirPath, dir.Path)) {
+			continue
+		}
+
+		found = true
+
+		if dir.Mode != "" {
+			result.Mode = dir.Mode
+		}
+
+		if dir.Owner != "" {
+			result.Owner = dir.Owner
+		}
+
+		if dir.Group != "" {
+			result.Group = dir.Group
+		}
+	}
+
+	return result, found
+}
+
+// InRecursiveDirectory returns true if a path is located below the path of
+// a recursive directory rule.
+func (c *GenerationConfig) InRecursiveDirectory(filePath string) bool {
+	for _, dir := range c.Directories {
+		if dir.Recursive && isSubpath(filePath, dir.Path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSubpath returns true if filePath is located below dirPath.
+func isSubpath(filePath, dirPath string) bool {
+	if dirPath == "/" {
+		return filePath != "/"
+	}
+
+	return strings.HasPrefix(filePath, dirPath+"/")
+}
+
+func (file *GenerationConfigFile) Match(filePath string) bool {
+	switch {
+	case file.Path != "":
+		return file.Path == filePath
+
+	case file.PathGlob != "":
+		return MatchGlob(file.PathGlob, filePath)
+
+	case file.PathRegexp != nil:
+		return file.PathRegexp.MatchString(filePath)
 	}
 
-	return GenerationConfigFile{}, false
+	return false
 }
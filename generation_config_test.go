@@ -0,0 +1,233 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testConfigHeader = `
+name: "test"
+version: "1.0.0"
+short_description: "test package"
+long_description: "test package"
+website_uri: "https://example.com"
+maintainer: "test <test@example.com>"
+`
+
+func loadTestConfig(t *testing.T, data string) *GenerationConfig {
+	t.Helper()
+
+	config := DefaultGenerationConfig()
+	if err := yaml.Unmarshal([]byte(testConfigHeader+data), config); err != nil {
+		t.Fatalf("cannot load configuration: %v", err)
+	}
+
+	return config
+}
+
+func TestGenerationConfigFindFile(t *testing.T) {
+	config := loadTestConfig(t, `
+directories:
+  - path: "/usr/local/www"
+    recursive: true
+    owner: "www"
+    group: "www"
+    file_mode: "640"
+  - path: "/usr/local/www/app/cache"
+    recursive: true
+    owner: "nobody"
+files:
+  - path_glob: "/usr/local/etc/**/*.conf"
+    mode: "600"
+    config: true
+  - path: "/usr/local/etc/app/app.conf"
+    owner: "app"
+  - path_regexp: "\\.sample$"
+    mode: "644"
+  - path_glob: "/usr/local/etc/app/*"
+    mode: "400"
+  - path: "/usr/local/www/app/index.php"
+    mode: "644"
+  - path_glob: "/usr/local/www/**/*.sh"
+    mode: "750"
+    group: "wheel"
+`)
+
+	tests := []struct {
+		path   string
+		found  bool
+		result GenerationConfigFile
+	}{
+		{"/usr/local/bin/app", false,
+			GenerationConfigFile{}},
+
+		// Later rules override attributes set by earlier ones, and
+		// attributes they do not set are kept.
+		{"/usr/local/etc/app/app.conf", true,
+			GenerationConfigFile{Mode: "400", Owner: "app", Config: true}},
+		{"/usr/local/etc/other/other.conf", true,
+			GenerationConfigFile{Mode: "600", Config: true}},
+		{"/usr/local/etc/app/app.conf.sample", true,
+			GenerationConfigFile{Mode: "400"}},
+		{"/usr/local/share/app.sample", true,
+			GenerationConfigFile{Mode: "644"}},
+
+		// Recursive directory rules are applied before file rules, in the
+		// order they are declared.
+		{"/usr/local/www/app/style.css", true,
+			GenerationConfigFile{Mode: "640", Owner: "www", Group: "www"}},
+		{"/usr/local/www/app/index.php", true,
+			GenerationConfigFile{Mode: "644", Owner: "www", Group: "www"}},
+		{"/usr/local/www/app/cache/data", true,
+			GenerationConfigFile{Mode: "640", Owner: "nobody", Group: "www"}},
+		{"/usr/local/www/app/cache/clean.sh", true,
+			GenerationConfigFile{Mode: "750", Owner: "nobody",
+				Group: "wheel"}},
+		{"/usr/local/www", false,
+			GenerationConfigFile{}},
+	}
+
+	for _, test := range tests {
+		result, found := config.FindFile(test.path)
+		if found != test.found {
+			t.Errorf("%q: got found %t, expected %t",
+				test.path, found, test.found)
+			continue
+		}
+
+		if result != test.result {
+			t.Errorf("%q: got %#v, expected %#v",
+				test.path, result, test.result)
+		}
+	}
+}
+
+func TestGenerationConfigFindDirectory(t *testing.T) {
+	config := loadTestConfig(t, `
+directories:
+  - path: "/var/db/app"
+    recursive: true
+    owner: "app"
+    mode: "750"
+  - path: "/var/db/app/public"
+    mode: "755"
+  - path: "/var/db/app/public"
+    group: "www"
+`)
+
+	tests := []struct {
+		path   string
+		found  bool
+		result GenerationConfigDirectory
+	}{
+		{"/var/db", false,
+			GenerationConfigDirectory{}},
+		{"/var/db/app", true,
+			GenerationConfigDirectory{Mode: "750", Owner: "app"}},
+		{"/var/db/app/data", true,
+			GenerationConfigDirectory{Mode: "750", Owner: "app"}},
+		{"/var/db/app/public", true,
+			GenerationConfigDirectory{Mode: "755", Owner: "app",
+				Group: "www"}},
+	}
+
+	for _, test := range tests {
+		result, found := config.FindDirectory(test.path)
+		if found != test.found {
+			t.Errorf("%q: got found %t, expected %t",
+				test.path, found, test.found)
+			continue
+		}
+
+		if result != test.result {
+			t.Errorf("%q: got %#v, expected %#v",
+				test.path, result, test.result)
+		}
+	}
+}
+
+func TestGenerationConfigAccountIDs(t *testing.T) {
+	config := loadTestConfig(t, `
+users:
+  - name: "app"
+    uid: 800
+    group: "app"
+  - name: "www"
+    uid: 801
+    group: "app"
+groups:
+  - name: "app"
+    gid: 800
+user_ids:
+  app: 900
+  postgres: 770
+group_ids:
+  wheel: 10
+`)
+
+	userTests := []struct {
+		name  string
+		id    int
+		found bool
+	}{
+		{"app", 900, true},
+		{"www", 801, true},
+		{"postgres", 770, true},
+		{"root", 0, true},
+		{"nobody", 65534, true},
+		{"unknown", 0, false},
+	}
+
+	for _, test := range userTests {
+		id, found := config.UserID(test.name)
+		if id != test.id || found != test.found {
+			t.Errorf("user %q: got (%d, %t), expected (%d, %t)",
+				test.name, id, found, test.id, test.found)
+		}
+	}
+
+	groupTests := []struct {
+		name  string
+		id    int
+		found bool
+	}{
+		{"app", 800, true},
+		{"wheel", 10, true},
+		{"unknown", 0, false},
+	}
+
+	for _, test := range groupTests {
+		id, found := config.GroupID(test.name)
+		if id != test.id || found != test.found {
+			t.Errorf("group %q: got (%d, %t), expected (%d, %t)",
+				test.name, id, found, test.id, test.found)
+		}
+	}
+}
+
+func TestGenerationConfigNegativeAccountIDs(t *testing.T) {
+	for _, data := range []string{
+		"user_ids:\n  app: -1\n",
+		"group_ids:\n  app: -2\n",
+	} {
+		config := DefaultGenerationConfig()
+		if err := yaml.Unmarshal([]byte(testConfigHeader+data), config); err == nil {
+			t.Errorf("%q: missing error", data)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Glob patterns use the syntax of path.Match for each path element; in
+// addition, a "**" element matches any number of path elements, including
+// none. For example, "/usr/local/**/*.so" matches both "/usr/local/a.so" and
+// "/usr/local/lib/x/b.so".
+
+func ValidateGlob(pattern string) error {
+	for _, element := range strings.Split(pattern, "/") {
+		if _, err := path.Match(element, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+func MatchGlob(pattern, filePath string) bool {
+	return matchGlobElements(strings.Split(pattern, "/"),
+		strings.Split(filePath, "/"))
+}
+
+func matchGlobElements(patterns, elements []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for len(patterns) > 0 && patterns[0] == "**" {
+				patterns = patterns[1:]
+			}
+
+			if len(patterns) == 0 {
+				return true
+			}
+
+			for i := range elements {
+				if matchGlobElements(patterns, elements[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(elements) == 0 {
+			return false
+		}
+
+		matched, err := path.Match(patterns[0], elements[0])
+		if err != nil || !matched {
+			return false
+		}
+
+		patterns = patterns[1:]
+		elements = elements[1:]
+	}
+
+	return len(elements) == 0
+}
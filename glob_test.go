@@ -0,0 +1,68 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		{"/usr/local/bin/foo", "/usr/local/bin/foo", true},
+		{"/usr/local/bin/foo", "/usr/local/bin/bar", false},
+		{"/usr/local/bin/*", "/usr/local/bin/foo", true},
+		{"/usr/local/*", "/usr/local/bin/foo", false},
+		{"/usr/local/*/foo", "/usr/local/bin/foo", true},
+		{"/usr/local/lib/*.so.[0-9]", "/usr/local/lib/libfoo.so.1", true},
+		{"/usr/local/**/*.so", "/usr/local/a.so", true},
+		{"/usr/local/**/*.so", "/usr/local/lib/x/b.so", true},
+		{"/usr/local/**/*.so", "/usr/local/lib/x/b.so.1", false},
+		{"/usr/local/**/*.so", "/usr/a.so", false},
+		{"/usr/local/**", "/usr/local", true},
+		{"/usr/local/**", "/usr/local/share/doc/foo", true},
+		{"/usr/local/**/**/foo", "/usr/local/foo", true},
+		{"/**/foo", "/usr/local/foo", true},
+		{"/**/foo", "/usr/local/foobar", false},
+		{"/usr/**/share/**/*.txt", "/usr/local/share/doc/a.txt", true},
+		{"/usr/**/share/**/*.txt", "/usr/local/lib/doc/a.txt", false},
+		{"/usr/local/[", "/usr/local/[", false},
+	}
+
+	for _, test := range tests {
+		matches := MatchGlob(test.pattern, test.path)
+		if matches != test.matches {
+			t.Errorf("%q, %q: got %t, expected %t",
+				test.pattern, test.path, matches, test.matches)
+		}
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	valid := []string{"/usr/local/**/*.so", "*.txt", "/etc/[a-z]*"}
+	for _, pattern := range valid {
+		if err := ValidateGlob(pattern); err != nil {
+			t.Errorf("%q: unexpected error: %v", pattern, err)
+		}
+	}
+
+	invalid := []string{"/usr/local/[", "/etc/[a-"}
+	for _, pattern := range invalid {
+		if err := ValidateGlob(pattern); err == nil {
+			t.Errorf("%q: missing error", pattern)
+		}
+	}
+}
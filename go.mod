@@ -3,6 +3,10 @@ module github.com/exograd/fpkg
 go 1.18
 
 require (
+	github.com/dsnet/compress v0.0.1
 	github.com/exograd/go-program v0.0.0-20220116124618-691d97553601
+	github.com/klauspost/compress v1.16.7
+	github.com/ulikunitz/xz v0.5.9
+	github.com/yuin/gopher-lua v1.1.1
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -22,53 +22,180 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 )
 
-func WalkDir(dirPath string, fn func(string, fs.FileInfo) error) error {
-	var walk func(string, string) error
-	walk = func(currentPath, relPath string) error {
-		info, err := os.Stat(currentPath)
+// FileID identifies a file on the local system. Paths with the same FileID
+// are hard links to the same file.
+type FileID struct {
+	Device uint64
+	Inode  uint64
+}
+
+type WalkDirOptions struct {
+	// If FollowSymlinks is true, symbolic links are reported as the file or
+	// directory they point to instead of being reported as links.
+	FollowSymlinks bool
+
+	// If Filter is not nil, it is called for each path found; paths for
+	// which it returns false are ignored, and so is the content of ignored
+	// directories.
+	Filter func(string, fs.FileInfo) bool
+
+	// If AllDirectories is true, fn is called for every directory below
+	// the root directory after its content, and not only for empty
+	// directories.
+	AllDirectories bool
+}
+
+// WalkDir calls fn for every file and every empty directory found in
+// dirPath. A directory whose content is entirely ignored is considered empty.
+func WalkDir(dirPath string, options WalkDirOptions, fn func(string, fs.FileInfo) error) error {
+	// When following symbolic links, a link to the directory containing it
+	// or to one of its parents would make us walk the same directories
+	// forever, or the entire filesystem for a link to "/". We keep track of
+	// the directories being walked and of the parents of dirPath to detect
+	// these links.
+	var parentDirs map[FileID]struct{}
+	if options.FollowSymlinks {
+		var err error
+		parentDirs, err = parentDirectories(dirPath)
 		if err != nil {
-			return fmt.Errorf("cannot stat %q: %w", currentPath, err)
+			return err
+		}
+	}
+
+	var walk func(string, string) (bool, error)
+	walk = func(currentPath, relPath string) (bool, error) {
+		info, err := os.Lstat(currentPath)
+		if err != nil {
+			return false, fmt.Errorf("cannot stat %q: %w", currentPath, err)
+		}
+
+		// The directory itself can be a link even if links are not followed.
+		followLink := options.FollowSymlinks || relPath == "/"
+
+		if info.Mode()&fs.ModeSymlink != 0 && followLink {
+			info, err = os.Stat(currentPath)
+			if err != nil {
+				return false, fmt.Errorf("cannot stat %q: %w",
+					currentPath, err)
+			}
+		}
+
+		if relPath != "/" && options.Filter != nil {
+			if !options.Filter(relPath, info) {
+				return false, nil
+			}
 		}
 
 		isEmptyDir := false
 
+		if info.IsDir() && parentDirs != nil {
+			if id, ok := DirectoryIdentity(info); ok {
+				if _, found := parentDirs[id]; found {
+					return false, fmt.Errorf("symbolic link %q points to one "+
+						"of its parent directories", currentPath)
+				}
+
+				parentDirs[id] = struct{}{}
+				defer delete(parentDirs, id)
+			}
+		}
+
 		if info.IsDir() {
 			entries, err := ioutil.ReadDir(currentPath)
 			if err != nil {
-				return fmt.Errorf("cannot list directory %q: %w",
+				return false, fmt.Errorf("cannot list directory %q: %w",
 					currentPath, err)
 			}
 
-			isEmptyDir = len(entries) == 0
+			isEmptyDir = true
 
 			for _, entry := range entries {
 				currentPath2 := path.Join(currentPath, entry.Name())
 				relPath2 := path.Join(relPath, entry.Name())
 
-				if err := walk(currentPath2, relPath2); err != nil {
-					return err
+				visited, err := walk(currentPath2, relPath2)
+				if err != nil {
+					return false, err
+				}
+
+				if visited {
+					isEmptyDir = false
 				}
 			}
 		}
 
-		if !info.IsDir() || isEmptyDir {
+		reportDir := isEmptyDir || (options.AllDirectories && relPath != "/")
+
+		if !info.IsDir() || reportDir {
 			if err := fn(relPath, info); err != nil {
-				return err
+				return false, err
 			}
 		}
 
-		return nil
+		return true, nil
 	}
 
-	if err := walk(dirPath, "/"); err != nil {
+	if _, err := walk(dirPath, "/"); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// parentDirectories returns the identity of all directories containing
+// dirPath once symbolic links have been resolved.
+func parentDirectories(dirPath string) (map[FileID]struct{}, error) {
+	realPath, err := filepath.EvalSymlinks(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %q: %w", dirPath, err)
+	}
+
+	realPath, err = filepath.Abs(realPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %q: %w", dirPath, err)
+	}
+
+	dirs := make(map[FileID]struct{})
+
+	for realPath != filepath.Dir(realPath) {
+		realPath = filepath.Dir(realPath)
+
+		info, err := os.Stat(realPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot stat %q: %w", realPath, err)
+		}
+
+		if id, ok := DirectoryIdentity(info); ok {
+			dirs[id] = struct{}{}
+		}
+	}
+
+	return dirs, nil
+}
+
+// UnixPermissions returns the permission bits of a file mode, including the
+// setuid, setgid and sticky bits, as used in tar headers and pkg manifests.
+func UnixPermissions(mode fs.FileMode) int64 {
+	perm := int64(mode.Perm())
+
+	if mode&fs.ModeSetuid != 0 {
+		perm |= 04000
+	}
+
+	if mode&fs.ModeSetgid != 0 {
+		perm |= 02000
+	}
+
+	if mode&fs.ModeSticky != 0 {
+		perm |= 01000
+	}
+
+	return perm
+}
+
 func FileSHA256Checksum(filePath string) ([]byte, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -84,3 +211,18 @@ func FileSHA256Checksum(filePath string) ([]byte, error) {
 
 	return hash.Sum(nil), nil
 }
+
+func SymlinkSHA256Checksum(target string) []byte {
+	data := []byte(target)
+
+	// Pkg skips the leading slash of absolute link targets but still hashes
+	// as many bytes as the original target contains, i.e. the rest of the
+	// target followed by its final null byte. We have to do the same for
+	// checksums to match.
+	if len(target) > 0 && target[0] == '/' {
+		data = append(data[1:], 0)
+	}
+
+	checksum := sha256.Sum256(data)
+	return checksum[:]
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSymlinkSHA256Checksum(t *testing.T) {
+	tests := []struct {
+		target   string
+		checksum string
+	}{
+		{"/etc/passwd",
+			"f2b0c25a74e386cf8be1dcb96e7bec2ecf74d7b62080eef79785932b043c0284"},
+		{"etc/passwd",
+			"af896a5f354b5297fb7dde9efe8f2b1de11e2fc5315fe28ce1d7468c1953b7ab"},
+		{"",
+			"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+
+	for _, test := range tests {
+		checksum := hex.EncodeToString(SymlinkSHA256Checksum(test.target))
+		if checksum != test.checksum {
+			t.Errorf("%q: got %s, expected %s",
+				test.target, checksum, test.checksum)
+		}
+	}
+}
+
+func TestWalkDirSymlinkCycles(t *testing.T) {
+	dirPath := t.TempDir()
+
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		t.Fatalf("cannot stat %q: %v", dirPath, err)
+	}
+
+	if _, ok := DirectoryIdentity(info); !ok {
+		t.Skip("directory identities are not available")
+	}
+
+	mkdir := func(name string) {
+		t.Helper()
+
+		if err := os.MkdirAll(filepath.Join(dirPath, name), 0755); err != nil {
+			t.Fatalf("cannot create directory: %v", err)
+		}
+	}
+
+	symlink := func(target, name string) {
+		t.Helper()
+
+		if err := os.Symlink(target, filepath.Join(dirPath, name)); err != nil {
+			t.Fatalf("cannot create symlink: %v", err)
+		}
+	}
+
+	mkdir("ok/share/data")
+	symlink("share/data", "ok/data")
+	symlink("../ok/share", "ok/share2")
+
+	mkdir("parent/lib")
+	symlink("..", "parent/lib/up")
+
+	mkdir("self")
+	symlink(".", "self/here")
+
+	mkdir("root")
+	symlink("/", "root/root")
+
+	tests := []struct {
+		dir  string
+		link string
+	}{
+		{"ok", ""},
+		{"parent", "parent/lib/up"},
+		{"self", "self/here"},
+		{"root", "root/root"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dir, func(t *testing.T) {
+			options := WalkDirOptions{FollowSymlinks: true}
+
+			err := WalkDir(filepath.Join(dirPath, test.dir), options,
+				func(string, fs.FileInfo) error { return nil })
+
+			if test.link == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("missing error")
+			}
+
+			linkPath := filepath.Join(dirPath, test.link)
+			if !strings.Contains(err.Error(), linkPath) {
+				t.Errorf("error %q does not name %q", err, linkPath)
+			}
+		})
+	}
+}
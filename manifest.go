@@ -28,21 +28,47 @@ import (
 // See https://github.com/freebsd/pkg/blob/master/libpkg/pkg_manifest.c
 
 type Manifest struct {
-	Name        string              `json:"name"`
-	Version     string              `json:"version"`
-	Comment     string              `json:"comment"`
-	Desc        string              `json:"desc"`
-	Origin      string              `json:"origin"`
-	WWW         string              `json:"www,omitempty"`
-	Maintainer  string              `json:"maintainer,omitempty"`
-	Arch        string              `json:"arch"`
-	Deps        ManifestDeps        `json:"deps,omitempty"`
-	Users       []string            `json:"users,omitempty"`
-	Groups      []string            `json:"groups,omitempty"`
-	Prefix      string              `json:"prefix,omitempty"`
-	Files       ManifestFiles       `json:"files,omitempty"`
-	Directories ManifestDirectories `json:"directories,omitempty"`
-	Scripts     map[string]string   `json:"scripts"`
+	Name           string              `json:"name"`
+	Version        string              `json:"version"`
+	Comment        string              `json:"comment"`
+	Desc           string              `json:"desc"`
+	Origin         string              `json:"origin"`
+	WWW            string              `json:"www,omitempty"`
+	Maintainer     string              `json:"maintainer,omitempty"`
+	ABI            string              `json:"abi,omitempty"`
+	Arch           string              `json:"arch"`
+	LicenseLogic   string              `json:"licenselogic,omitempty"`
+	Licenses       []string            `json:"licenses,omitempty"`
+	Categories     []string            `json:"categories,omitempty"`
+	Annotations    map[string]string   `json:"annotations,omitempty"`
+	Options        map[string]string   `json:"options,omitempty"`
+	Vital          bool                `json:"vital,omitempty"`
+	Deps           ManifestDeps        `json:"deps,omitempty"`
+	Provides       []string            `json:"provides,omitempty"`
+	Requires       []string            `json:"requires,omitempty"`
+	Conflicts      []string            `json:"conflicts,omitempty"`
+	Users          []string            `json:"users,omitempty"`
+	Groups         []string            `json:"groups,omitempty"`
+	ShlibsRequired []string            `json:"shlibs_required,omitempty"`
+	ShlibsProvided []string            `json:"shlibs_provided,omitempty"`
+	Prefix         string              `json:"prefix,omitempty"`
+	Flatsize       int64               `json:"flatsize"`
+	Files          ManifestFiles       `json:"files,omitempty"`
+	Config         []string            `json:"config,omitempty"`
+	Directories    ManifestDirectories `json:"directories,omitempty"`
+	Scripts        map[string]string   `json:"scripts,omitempty"`
+	LuaScripts     map[string][]string `json:"lua_scripts,omitempty"`
+	Messages       []ManifestMessage   `json:"messages,omitempty"`
+
+	// The path of the local file corresponding to each packaged file.
+	sourcePaths map[string]string
+}
+
+type ManifestMessage struct {
+	Message        string `json:"message"`
+	Type           string `json:"type,omitempty"`
+	MinimumVersion string `json:"minimum_version,omitempty"`
+	MaximumVersion string `json:"maximum_version,omitempty"`
 }
 
 type ManifestDep struct {
@@ -74,9 +100,28 @@ func NewManifest() *Manifest {
 		Files:       make(ManifestFiles),
 		Directories: make(ManifestDirectories),
 		Scripts:     make(map[string]string),
+
+		sourcePaths: make(map[string]string),
 	}
 }
 
+// Compact returns a copy of the manifest without the file list, the
+// configuration file list, the directory list, scripts, Lua scripts and
+// messages. Pkg stores this compact version as the first entry of the archive
+// so that package metadata can be read without loading the whole manifest.
+func (m *Manifest) Compact() *Manifest {
+	cm := *m
+
+	cm.Files = nil
+	cm.Config = nil
+	cm.Directories = nil
+	cm.Scripts = nil
+	cm.LuaScripts = nil
+	cm.Messages = nil
+
+	return &cm
+}
+
 func (m *Manifest) PackageFilename() string {
 	return m.Name + "-" + m.Version + ".pkg"
 }
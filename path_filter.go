@@ -0,0 +1,133 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// A path is ignored if it matches at least one exclusion pattern and no
+// inclusion pattern. Ignoring a directory also ignores its content. As in
+// .gitignore files, glob patterns ending with '/' only match directories.
+
+const IgnoreFileName = ".fpkgignore"
+
+type PathFilter struct {
+	Excludes []GenerationConfigPattern
+	Includes []GenerationConfigPattern
+}
+
+func (f *PathFilter) Accept(filePath string, isDir bool) bool {
+	if !matchAnyPattern(f.Excludes, filePath, isDir) {
+		return true
+	}
+
+	return matchAnyPattern(f.Includes, filePath, isDir)
+}
+
+func matchAnyPattern(patterns []GenerationConfigPattern, filePath string, isDir bool) bool {
+	for _, pattern := range patterns {
+		if pattern.Match(filePath, isDir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LoadIgnoreFile reads patterns from a file using one glob pattern per line.
+// Empty lines and lines starting with '#' are ignored; patterns starting with
+// '!' are inclusion patterns.
+func (f *PathFilter) LoadIgnoreFile(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		include := false
+		if line[0] == '!' {
+			include = true
+			line = line[1:]
+		}
+
+		pattern := GenerationConfigPattern{Glob: line}
+		if err := pattern.Validate(); err != nil {
+			return fmt.Errorf("%s:%d: %w", filePath, lineNumber, err)
+		}
+
+		if include {
+			f.Includes = append(f.Includes, pattern)
+		} else {
+			f.Excludes = append(f.Excludes, pattern)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// Match returns true if a path matches the pattern. Glob patterns which do
+// not contain any '/' character are matched against the last element of the
+// path; other glob patterns and regular expressions are matched against the
+// whole path. Glob patterns ending with '/' only match directories.
+func (p *GenerationConfigPattern) Match(filePath string, isDir bool) bool {
+	if p.Regexp != nil {
+		return p.Regexp.MatchString(filePath)
+	}
+
+	glob := p.Glob
+
+	if strings.HasSuffix(glob, "/") {
+		if !isDir {
+			return false
+		}
+
+		glob = strings.TrimSuffix(glob, "/")
+	}
+
+	if !strings.Contains(glob, "/") {
+		return MatchGlob(glob, path.Base(filePath))
+	}
+
+	if !strings.HasPrefix(glob, "/") {
+		glob = "/" + glob
+	}
+
+	return MatchGlob(glob, filePath)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import "testing"
+
+func TestGenerationConfigPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern GenerationConfigPattern
+		path    string
+		matches bool
+	}{
+		{GenerationConfigPattern{Glob: "*.o"}, "/src/main.o", true},
+		{GenerationConfigPattern{Glob: "*.o"}, "/main.o", true},
+		{GenerationConfigPattern{Glob: "*.o"}, "/src/main.c", false},
+		{GenerationConfigPattern{Glob: ".git"}, "/a/b/.git", true},
+		{GenerationConfigPattern{Glob: "/doc/*"}, "/doc/README", true},
+		{GenerationConfigPattern{Glob: "/doc/*"}, "/src/doc/README", false},
+		{GenerationConfigPattern{Glob: "doc/*"}, "/doc/README", true},
+		{GenerationConfigPattern{Glob: "doc/**"}, "/doc/a/b", true},
+		{GenerationConfigPattern{Glob: "**/*.tmp"}, "/a/b/c.tmp", true},
+		{GenerationConfigPattern{RegexpString: `\.(c|h)$`}, "/src/x.c", true},
+		{GenerationConfigPattern{RegexpString: `\.(c|h)$`}, "/src/x.o", false},
+		{GenerationConfigPattern{RegexpString: `^/src/`}, "/src/x.c", true},
+		{GenerationConfigPattern{RegexpString: `^/src/`}, "/lib/src/x", false},
+	}
+
+	for _, test := range tests {
+		pattern := test.pattern
+		if err := pattern.Validate(); err != nil {
+			t.Fatalf("invalid pattern %#v: %v", pattern, err)
+		}
+
+		if matches := pattern.Match(test.path, false); matches != test.matches {
+			t.Errorf("%#v, %q: got %t, expected %t",
+				test.pattern, test.path, matches, test.matches)
+		}
+	}
+}
+
+func TestGenerationConfigPatternMatchDirectory(t *testing.T) {
+	tests := []struct {
+		glob    string
+		path    string
+		isDir   bool
+		matches bool
+	}{
+		{".git/", "/.git", true, true},
+		{".git/", "/a/b/.git", true, true},
+		{".git/", "/.git", false, false},
+		{"build/", "/build", true, true},
+		{"build/", "/a/build", true, true},
+		{"build/", "/a/build", false, false},
+		{"/build/", "/build", true, true},
+		{"/build/", "/a/build", true, false},
+		{"doc/*/", "/doc/a", true, true},
+		{"doc/*/", "/doc/a", false, false},
+		{".git", "/.git", true, true},
+	}
+
+	for _, test := range tests {
+		pattern := GenerationConfigPattern{Glob: test.glob}
+		if err := pattern.Validate(); err != nil {
+			t.Fatalf("invalid pattern %q: %v", test.glob, err)
+		}
+
+		matches := pattern.Match(test.path, test.isDir)
+		if matches != test.matches {
+			t.Errorf("%q, %q, directory %t: got %t, expected %t",
+				test.glob, test.path, test.isDir, matches, test.matches)
+		}
+	}
+}
+
+func TestPathFilterAccept(t *testing.T) {
+	filter := PathFilter{
+		Excludes: []GenerationConfigPattern{{Glob: "*.log"}, {Glob: "tmp/"}},
+		Includes: []GenerationConfigPattern{{Glob: "/var/log/keep.log"}},
+	}
+
+	tests := []struct {
+		path   string
+		isDir  bool
+		accept bool
+	}{
+		{"/var/log/app.log", false, false},
+		{"/var/log/keep.log", false, true},
+		{"/var/log/app.txt", false, true},
+		{"/var/tmp", true, false},
+		{"/var/tmp", false, true},
+	}
+
+	for _, test := range tests {
+		if accept := filter.Accept(test.path, test.isDir); accept != test.accept {
+			t.Errorf("%q: got %t, expected %t", test.path, accept, test.accept)
+		}
+	}
+}
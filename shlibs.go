@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// analyzeSharedLibraries finds the shared libraries provided and required by
+// ELF files in the package. Libraries provided by the package itself, either
+// through their soname or because they are found in the library search path
+// of the file requiring them, are not required.
+func analyzeSharedLibraries(config *GenerationConfig, entries []*ChecksumEntry, elfFiles map[string]*ELFFile) ([]string, []string) {
+	required := make(map[string]struct{})
+	provided := make(map[string]struct{})
+
+	packagePaths := make(map[string]struct{})
+	for _, entry := range entries {
+		packagePaths[entry.PackagePath] = struct{}{}
+	}
+
+	if config.DetectShlibs {
+		for packagePath, elfFile := range elfFiles {
+			if elfFile.SOName != "" {
+				provided[elfFile.SOName] = struct{}{}
+			}
+
+			origin := path.Dir(packagePath)
+
+			for _, lib := range elfFile.Needed {
+				if !packageContainsLibrary(packagePaths, elfFile.RPaths,
+					origin, lib) {
+					required[lib] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for _, lib := range config.ShlibsProvided {
+		provided[lib] = struct{}{}
+	}
+
+	for lib := range provided {
+		delete(required, lib)
+	}
+
+	for lib := range required {
+		if config.IgnoreShlib(lib) {
+			delete(required, lib)
+		}
+	}
+
+	for _, lib := range config.ShlibsRequired {
+		required[lib] = struct{}{}
+	}
+
+	return sortedKeys(required), sortedKeys(provided)
+}
+
+func packageContainsLibrary(packagePaths map[string]struct{}, rpaths []string, origin, lib string) bool {
+	for _, rpath := range rpaths {
+		rpath = strings.ReplaceAll(rpath, "${ORIGIN}", origin)
+		rpath = strings.ReplaceAll(rpath, "$ORIGIN", origin)
+
+		if _, found := packagePaths[path.Join(rpath, lib)]; found {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	if len(m) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
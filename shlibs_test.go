@@ -0,0 +1,179 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeSharedLibraries(t *testing.T) {
+	file := func(packagePath string) *ChecksumEntry {
+		return &ChecksumEntry{
+			FilePath:    "/src" + packagePath,
+			PackagePath: packagePath,
+			Info:        testFileInfo{mode: 0755},
+		}
+	}
+
+	entries := []*ChecksumEntry{
+		file("/usr/local/bin/app"),
+		file("/usr/local/lib/libapp.so.1"),
+		file("/usr/local/lib/app/libplugin.so"),
+		file("/usr/local/libexec/app/libhelper.so"),
+	}
+
+	tests := []struct {
+		name     string
+		config   GenerationConfig
+		elfFiles map[string]*ELFFile
+		required []string
+		provided []string
+	}{
+		{"no files",
+			GenerationConfig{DetectShlibs: true},
+			nil,
+			nil, nil},
+		{"system libraries",
+			GenerationConfig{DetectShlibs: true},
+			map[string]*ELFFile{
+				"/usr/local/bin/app": {
+					Needed: []string{"libc.so.7", "libm.so.5"},
+				},
+			},
+			[]string{"libc.so.7", "libm.so.5"}, nil},
+		{"self-provided soname",
+			GenerationConfig{DetectShlibs: true},
+			map[string]*ELFFile{
+				"/usr/local/bin/app": {
+					Needed: []string{"libapp.so.1", "libc.so.7"},
+				},
+				"/usr/local/lib/libapp.so.1": {
+					SOName: "libapp.so.1",
+					Needed: []string{"libc.so.7"},
+				},
+			},
+			[]string{"libc.so.7"}, []string{"libapp.so.1"}},
+		{"absolute rpath",
+			GenerationConfig{DetectShlibs: true},
+			map[string]*ELFFile{
+				"/usr/local/bin/app": {
+					Needed: []string{"libplugin.so", "libother.so"},
+					RPaths: []string{"/usr/local/lib/app"},
+				},
+			},
+			[]string{"libother.so"}, nil},
+		{"origin rpath",
+			GenerationConfig{DetectShlibs: true},
+			map[string]*ELFFile{
+				"/usr/local/bin/app": {
+					Needed: []string{"libplugin.so"},
+					RPaths: []string{"$ORIGIN/../lib/app"},
+				},
+			},
+			nil, nil},
+		{"braced origin rpath",
+			GenerationConfig{DetectShlibs: true},
+			map[string]*ELFFile{
+				"/usr/local/bin/app": {
+					Needed: []string{"libhelper.so"},
+					RPaths: []string{"/nowhere", "${ORIGIN}/../libexec/app"},
+				},
+			},
+			nil, nil},
+		{"rpath of another file",
+			GenerationConfig{DetectShlibs: true},
+			map[string]*ELFFile{
+				"/usr/local/bin/app": {
+					Needed: []string{"libplugin.so"},
+				},
+				"/usr/local/lib/libapp.so.1": {
+					RPaths: []string{"$ORIGIN/app"},
+				},
+			},
+			[]string{"libplugin.so"}, nil},
+		{"ignored libraries",
+			GenerationConfig{
+				DetectShlibs: true,
+				ShlibsIgnore: []string{"libm.so.*", "libapp.so.1"},
+			},
+			map[string]*ELFFile{
+				"/usr/local/bin/app": {
+					Needed: []string{"libc.so.7", "libm.so.5"},
+				},
+				"/usr/local/lib/libapp.so.1": {
+					SOName: "libapp.so.1",
+				},
+			},
+			[]string{"libc.so.7"}, []string{"libapp.so.1"}},
+		{"overrides",
+			GenerationConfig{
+				DetectShlibs:   true,
+				ShlibsRequired: []string{"libx.so.1"},
+				ShlibsProvided: []string{"libm.so.5", "liby.so.2"},
+			},
+			map[string]*ELFFile{
+				"/usr/local/bin/app": {
+					Needed: []string{"libc.so.7", "libm.so.5"},
+				},
+			},
+			[]string{"libc.so.7", "libx.so.1"},
+			[]string{"libm.so.5", "liby.so.2"}},
+		{"required override of a provided library",
+			GenerationConfig{
+				DetectShlibs:   true,
+				ShlibsRequired: []string{"libapp.so.1"},
+				ShlibsIgnore:   []string{"*"},
+			},
+			map[string]*ELFFile{
+				"/usr/local/lib/libapp.so.1": {
+					SOName: "libapp.so.1",
+					Needed: []string{"libc.so.7"},
+				},
+			},
+			[]string{"libapp.so.1"}, []string{"libapp.so.1"}},
+		{"detection disabled",
+			GenerationConfig{
+				ShlibsRequired: []string{"libx.so.1"},
+				ShlibsProvided: []string{"liby.so.2"},
+			},
+			map[string]*ELFFile{
+				"/usr/local/bin/app": {
+					Needed: []string{"libc.so.7"},
+				},
+				"/usr/local/lib/libapp.so.1": {
+					SOName: "libapp.so.1",
+				},
+			},
+			[]string{"libx.so.1"}, []string{"liby.so.2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			required, provided := analyzeSharedLibraries(&test.config,
+				entries, test.elfFiles)
+
+			if !reflect.DeepEqual(required, test.required) {
+				t.Errorf("got required libraries %v, expected %v",
+					required, test.required)
+			}
+
+			if !reflect.DeepEqual(provided, test.provided) {
+				t.Errorf("got provided libraries %v, expected %v",
+					provided, test.provided)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+)
+
+// collectSourceFiles returns the files, symbolic links and directories of all
+// sources, sorted by package path.
+func collectSourceFiles(config *GenerationConfig) ([]*ChecksumEntry, error) {
+	var entries []*ChecksumEntry
+
+	for _, source := range config.Sources {
+		sourceEntries, err := collectSource(config, source)
+		if err != nil {
+			return nil, fmt.Errorf("cannot collect files from %q: %w",
+				source.Path, err)
+		}
+
+		entries = append(entries, sourceEntries...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].PackagePath < entries[j].PackagePath
+	})
+
+	return uniqueSourceEntries(entries)
+}
+
+// uniqueSourceEntries removes duplicate directories from a list of entries.
+// Several sources can contain the same directory, but any other entries
+// sharing the same package path, whatever their order, are an error.
+func uniqueSourceEntries(entries []*ChecksumEntry) ([]*ChecksumEntry, error) {
+	seenEntries := make(map[string]*ChecksumEntry)
+
+	uniqueEntries := make([]*ChecksumEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry2, found := seenEntries[entry.PackagePath]; found {
+			if entry2.Info.IsDir() && entry.Info.IsDir() {
+				continue
+			}
+
+			return nil, fmt.Errorf("%q and %q are both packaged as %q",
+				entry2.FilePath, entry.FilePath, entry.PackagePath)
+		}
+
+		seenEntries[entry.PackagePath] = entry
+		uniqueEntries = append(uniqueEntries, entry)
+	}
+
+	return uniqueEntries, nil
+}
+
+func collectSource(config *GenerationConfig, source GenerationConfigSource) ([]*ChecksumEntry, error) {
+	followSymlinks := config.Symlinks == SymlinkPolicyFollow
+
+	info, err := os.Lstat(source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat %q: %w", source.Path, err)
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		info2, err := os.Stat(source.Path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot stat %q: %w", source.Path, err)
+		}
+
+		if followSymlinks || info2.IsDir() {
+			info = info2
+		}
+	}
+
+	if !info.IsDir() {
+		if !isPackagedFile(info) {
+			return nil, fmt.Errorf("%q is neither a regular file nor a "+
+				"symbolic link", source.Path)
+		}
+
+		entry := ChecksumEntry{
+			FilePath:    source.Path,
+			PackagePath: source.Destination,
+			Info:        info,
+		}
+
+		return []*ChecksumEntry{&entry}, nil
+	}
+
+	filter := PathFilter{
+		Excludes: config.Exclude,
+		Includes: config.Include,
+	}
+
+	ignoreFilePath := path.Join(source.Path, IgnoreFileName)
+	if err := filter.LoadIgnoreFile(ignoreFilePath); err != nil {
+		return nil, err
+	}
+
+	walkOptions := WalkDirOptions{
+		FollowSymlinks: followSymlinks,
+		AllDirectories: true,
+		Filter: func(relPath string, info fs.FileInfo) bool {
+			return relPath != "/"+IgnoreFileName && filter.Accept(relPath, info.IsDir())
+		},
+	}
+
+	var entries []*ChecksumEntry
+
+	err = WalkDir(source.Path, walkOptions, func(relPath string, info fs.FileInfo) error {
+		if !isPackagedFile(info) && !info.IsDir() {
+			return nil
+		}
+
+		if relPath == "/" {
+			return nil
+		}
+
+		entries = append(entries, &ChecksumEntry{
+			FilePath:    path.Join(source.Path, relPath),
+			PackagePath: path.Join(source.Destination, relPath),
+			Info:        info,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func isPackagedFile(info fs.FileInfo) bool {
+	return info.Mode().IsRegular() || info.Mode()&fs.ModeSymlink != 0
+}
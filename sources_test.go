@@ -0,0 +1,144 @@
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package main
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+)
+
+type testFileInfo struct {
+	name string
+	mode fs.FileMode
+}
+
+func (info testFileInfo) Name() string       { return info.name }
+func (info testFileInfo) Size() int64        { return 0 }
+func (info testFileInfo) Mode() fs.FileMode  { return info.mode }
+func (info testFileInfo) ModTime() time.Time { return time.Time{} }
+func (info testFileInfo) IsDir() bool        { return info.mode.IsDir() }
+func (info testFileInfo) Sys() interface{}   { return nil }
+
+func TestUniqueSourceEntries(t *testing.T) {
+	dir := func(filePath, packagePath string) *ChecksumEntry {
+		return &ChecksumEntry{
+			FilePath:    filePath,
+			PackagePath: packagePath,
+			Info:        testFileInfo{mode: fs.ModeDir | 0755},
+		}
+	}
+
+	file := func(filePath, packagePath string) *ChecksumEntry {
+		return &ChecksumEntry{
+			FilePath:    filePath,
+			PackagePath: packagePath,
+			Info:        testFileInfo{mode: 0644},
+		}
+	}
+
+	symlink := func(filePath, packagePath string) *ChecksumEntry {
+		return &ChecksumEntry{
+			FilePath:    filePath,
+			PackagePath: packagePath,
+			Info:        testFileInfo{mode: fs.ModeSymlink | 0777},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		entries []*ChecksumEntry
+		paths   []string
+		err     bool
+	}{
+		{"distinct entries",
+			[]*ChecksumEntry{
+				dir("/a/bin", "/bin"),
+				file("/a/bin/x", "/bin/x"),
+				file("/b/bin/y", "/bin/y"),
+			},
+			[]string{"/bin", "/bin/x", "/bin/y"}, false},
+		{"shared directories",
+			[]*ChecksumEntry{
+				dir("/a/bin", "/bin"),
+				dir("/b/bin", "/bin"),
+				file("/a/bin/x", "/bin/x"),
+			},
+			[]string{"/bin", "/bin/x"}, false},
+		{"duplicate files",
+			[]*ChecksumEntry{
+				file("/a/bin/x", "/bin/x"),
+				file("/b/bin/x", "/bin/x"),
+			},
+			nil, true},
+		{"file and symlink",
+			[]*ChecksumEntry{
+				file("/a/bin/x", "/bin/x"),
+				symlink("/b/bin/x", "/bin/x"),
+			},
+			nil, true},
+		{"file then directory",
+			[]*ChecksumEntry{
+				file("/a/share/x", "/share/x"),
+				dir("/b/share/x", "/share/x"),
+			},
+			nil, true},
+		{"directory then file",
+			[]*ChecksumEntry{
+				dir("/a/share/x", "/share/x"),
+				file("/b/share/x", "/share/x"),
+			},
+			nil, true},
+		{"directories then file",
+			[]*ChecksumEntry{
+				dir("/a/share/x", "/share/x"),
+				dir("/b/share/x", "/share/x"),
+				file("/c/share/x", "/share/x"),
+			},
+			nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := uniqueSourceEntries(test.entries)
+			if test.err {
+				if err == nil {
+					t.Fatalf("missing error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var paths []string
+			for _, entry := range entries {
+				paths = append(paths, entry.PackagePath)
+			}
+
+			if len(paths) != len(test.paths) {
+				t.Fatalf("got paths %v, expected %v", paths, test.paths)
+			}
+
+			for i := range paths {
+				if paths[i] != test.paths[i] {
+					t.Fatalf("got paths %v, expected %v", paths, test.paths)
+				}
+			}
+		})
+	}
+}